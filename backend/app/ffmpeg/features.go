@@ -0,0 +1,16 @@
+package ffmpeg
+
+import (
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Features lists the processing options that depend on how the local ffmpeg
+// was built so clients can hide the ones that aren't available
+func Features(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"stabilize": service.Stabilizer() != "",
+	})
+}
@@ -10,8 +10,12 @@ import (
 	"context"
 	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -92,10 +96,181 @@ func Process(c *gin.Context, d *types.Dependencies) {
 		return
 	}
 
+	if opts.SubtitleFile != nil {
+		subPath, err := saveFormFile(opts.SubtitleFile, "subtitles")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to save subtitle file", zap.Error(err))
+			return
+		}
+		defer os.Remove(subPath)
+
+		opts.SubtitlePath = subPath
+	}
+
+	if opts.MusicFile != nil {
+		musicPath, err := saveFormFile(opts.MusicFile, "music")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to save music file", zap.Error(err))
+			return
+		}
+		defer os.Remove(musicPath)
+
+		opts.MusicPath = musicPath
+	}
+
+	cleanup, code, err := service.FetchOverlays(c.Request.Context(), d.DB, &opts, userID)
+	defer cleanup()
+
+	if err != nil {
+		if code == http.StatusInternalServerError {
+			zap.L().Error("Failed to fetch overlays", zap.Error(err))
+
+			err = errors.New("Internal server error")
+		}
+
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	shift, err := service.AlignToKeyframe(&opts, tempFile.Name())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to align trim to a keyframe", zap.Error(err))
+		return
+	}
+
+	// Lets the client know how far the start of a fast trim moved
+	c.Header("X-Trim-Start-Offset", strconv.FormatFloat(shift, 'f', 3, 64))
+
+	removed, err := service.RemoveSilences(c.Request.Context(), &opts, tempFile.Name(), userID, d.JobQueue)
+	if errors.Is(err, service.ErrAllSilent) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Removing silence wouldn't leave anything to render",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to detect silence", zap.Error(err))
+		return
+	}
+
+	if opts.RemoveSilence {
+		c.Header("X-Silence-Removed", strconv.FormatFloat(removed, 'f', 3, 64))
+	}
+
+	if err := service.CheckBufferedDuration(&opts, tempFile.Name()); err != nil {
+		if errors.Is(err, service.ErrTooLongToBuffer) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check clip duration", zap.Error(err))
+		return
+	}
+
+	if err := service.AnalyzeMotion(c.Request.Context(), &opts, tempFile.Name(), userID, d.JobQueue); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to analyze motion", zap.Error(err))
+		return
+	}
+
+	if opts.TransformsPath != "" {
+		defer os.Remove(opts.TransformsPath)
+	}
+
+	// Options that don't fit the video are reported here for looped clips as
+	// the clip is rendered before the flags of the output are made
+	if err := service.RenderLoop(c.Request.Context(), &opts, tempFile.Name(), userID, d.JobQueue); err != nil {
+		if errors.Is(err, service.ErrInvalidOptions) || errors.Is(err, service.ErrTooLongToBuffer) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrJobQueueFull) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":     "Job queue is full. Please wait a moment before trying again",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to render looped clip", zap.Error(err))
+		return
+	}
+
+	if opts.LoopPath != "" {
+		defer os.Remove(opts.LoopPath)
+	}
+
 	// shouldCleanup = false
 
+	// Flags are made before enqueueing so options that don't fit the video
+	// are reported to the user instead of failing the job
+	args, duration, err := d.JobQueue.MakeFFmpegFlags(&opts, tempFile.Name())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidOptions) || errors.Is(err, service.ErrTooLongToBuffer) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to prepare FFmpeg job", zap.Error(err))
+		return
+	}
+
 	if !opts.SaveToCloud {
-		c.Header("Content-Type", "video/mp4")
+		c.Header("Content-Type", opts.MimeType())
 		c.Header("Transfer-Encoding", "chunked")
 
 		ctxReq := c.Request.Context()
@@ -110,9 +285,9 @@ func Process(c *gin.Context, d *types.Dependencies) {
 		err = d.JobQueue.Enqueue(&service.FFmpegJob{
 			ID:       jobID,
 			UserID:   userID,
-			FilePath: tempFile.Name(),
 			Output:   c.Writer,
-			Opts:     &opts,
+			Args:     &args,
+			Duration: duration,
 			UseGPU:   true,
 			Ctx:      ctx,
 			Done:     done,
@@ -170,9 +345,9 @@ func Process(c *gin.Context, d *types.Dependencies) {
 	err = d.JobQueue.Enqueue(&service.FFmpegJob{
 		ID:       jobID,
 		UserID:   userID,
-		FilePath: tempFile.Name(),
 		Output:   tempProcessed,
-		Opts:     &opts,
+		Args:     &args,
+		Duration: duration,
 		UseGPU:   true,
 		Ctx:      ctx,
 		Done:     done,
@@ -206,7 +381,12 @@ func Process(c *gin.Context, d *types.Dependencies) {
 		return
 	}
 
-	fileEnt, err := d.Uploader.Do(tempProcessed.Name(), opts.File.Filename, userID)
+	name := opts.File.Filename
+	if opts.ExportFormat != "mp4" {
+		name = strings.TrimSuffix(name, path.Ext(name)) + "." + opts.ExportFormat
+	}
+
+	fileEnt, err := d.Uploader.DoAs(tempProcessed.Name(), name, userID, opts.MimeType())
 	if err != nil {
 		c.JSON(http.StatusRequestTimeout, gin.H{
 			"error":     "Internal server error",
@@ -249,4 +429,29 @@ func Process(c *gin.Context, d *types.Dependencies) {
 
 	redis.InvalidateCache("user:" + userID)
 	redis.InvalidateCache("profile:" + userID)
+
+	go d.Assets.Generate(*fileEnt)
+}
+
+// saveFormFile copies an uploaded subtitle or music file to disk, keeping
+// the extension so ffmpeg knows how to read it
+func saveFormFile(fh *multipart.FileHeader, prefix string) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	temp, err := os.CreateTemp("", prefix+"-*"+strings.ToLower(path.Ext(fh.Filename)))
+	if err != nil {
+		return "", err
+	}
+	defer temp.Close()
+
+	if _, err := io.Copy(temp, f); err != nil {
+		os.Remove(temp.Name())
+		return "", err
+	}
+
+	return temp.Name(), nil
 }
@@ -0,0 +1,75 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/validators"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PreviewAdjustments renders a single frame of a video with the color and
+// detail adjustments from the query applied
+func PreviewAdjustments(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var adjustments validators.Adjustments
+	if err := c.ShouldBindQuery(&adjustments); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid adjustments provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if err := adjustments.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	file, ok := ownedFile(c, d, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if file.Format != "video/mp4" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Only videos can be adjusted",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	timestamp, err := strconv.ParseFloat(c.DefaultQuery("timestamp", "0"), 64)
+	if err != nil || math.IsNaN(timestamp) || math.IsInf(timestamp, 0) || timestamp < 0 || (file.Duration > 0 && timestamp >= file.Duration) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid timestamp provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	framePath, err := service.PreviewAdjustments(c.Request.Context(), file.FileKey, timestamp, &adjustments, userID, d.JobQueue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to render adjusted frame", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer os.Remove(framePath)
+
+	c.Header("Cache-Control", "no-store")
+	c.File(framePath)
+}
@@ -0,0 +1,135 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AnalyzeSilence returns the parts of a file where the audio stays quiet,
+// using the same defaults as silence removal
+func AnalyzeSilence(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	noise, err := strconv.ParseFloat(c.DefaultQuery("threshold", "-35"), 64)
+	if err != nil || noise < -80 || noise > -10 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Threshold must be between -80 and -10 dB",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	minDuration, err := strconv.ParseFloat(c.DefaultQuery("minDuration", "1"), 64)
+	if err != nil || minDuration < 0.3 || minDuration > 30 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Minimum duration must be between 0.3 and 30 seconds",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	file, ok := ownedFile(c, d, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	ctxReq := c.Request.Context()
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	ctx, cancelMerged := util.MergeContexts(ctxReq, ctxTimeout)
+	defer cancelMerged()
+
+	p, err := service.DownloadFile(ctx, file.FileKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to download file", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer os.Remove(p)
+
+	silences, err := service.DetectSilence(ctx, p, noise, minDuration, 0, 0, userID, d.JobQueue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to detect silence", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"silences": silences,
+		"total":    silences.Duration(),
+	})
+}
+
+// AnalyzeCrop looks for black bars in a file and suggests crop options that
+// remove them
+func AnalyzeCrop(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	file, ok := ownedFile(c, d, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if file.Format != "video/mp4" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Only videos can be cropped",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	ctxReq := c.Request.Context()
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+
+	ctx, cancelMerged := util.MergeContexts(ctxReq, ctxTimeout)
+	defer cancelMerged()
+
+	p, err := service.DownloadFile(ctx, file.FileKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to download file", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer os.Remove(p)
+
+	crop, err := service.DetectCrop(ctx, p, userID, d.JobQueue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to detect crop", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	// A null crop means there's nothing to remove
+	c.JSON(http.StatusOK, gin.H{
+		"crop": crop,
+	})
+}
@@ -0,0 +1,426 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/redis"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type chapterRequest struct {
+	Title *string  `json:"title"`
+	Start *float64 `json:"start"`
+}
+
+type proposedChapter struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+}
+
+const (
+	maxChapters           = 100
+	defaultSceneThreshold = 0.4
+)
+
+// DetectChapters runs scene detection on a file and proposes chapter
+// markers. Nothing is saved until the user creates the chapters
+func DetectChapters(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	threshold := defaultSceneThreshold
+	if v := c.Query("threshold"); v != "" {
+		var err error
+
+		threshold, err = strconv.ParseFloat(v, 64)
+		if err != nil || threshold < 0.1 || threshold > 0.9 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Threshold must be between 0.1 and 0.9",
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
+	file, ok := ownedFile(c, d, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if file.Format != "video/mp4" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Scenes can only be detected in videos",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	ctxReq := c.Request.Context()
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	ctx, cancelMerged := util.MergeContexts(ctxReq, ctxTimeout)
+	defer cancelMerged()
+
+	p, err := service.DownloadFile(ctx, file.FileKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to download video", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer os.Remove(p)
+
+	scenes, err := service.DetectScenes(ctx, p, threshold, userID, d.JobQueue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to detect scenes", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	chapters := []proposedChapter{{Title: "Chapter 1", Start: 0}}
+	for _, t := range scenes[:min(len(scenes), maxChapters-1)] {
+		chapters = append(chapters, proposedChapter{
+			Title: fmt.Sprintf("Chapter %d", len(chapters)+1),
+			Start: t,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chapters": chapters,
+	})
+}
+
+// CreateChapter adds a chapter marker to a file
+func CreateChapter(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var req chapterRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Title == nil || req.Start == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid request body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	file, ok := ownedFile(c, d, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := validators.ChapterValidator(*req.Title, *req.Start, file.Duration); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var count int64
+	err := d.DB.Gorm.
+		Model(model.Chapter{}).
+		Where("file_id = ?", file.ID).
+		Count(&count).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to count chapters", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	if count >= maxChapters {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "A file can have at most 100 chapters",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	chapter := model.Chapter{
+		FileID:    file.ID,
+		UserID:    userID,
+		Title:     strings.TrimSpace(*req.Title),
+		Start:     *req.Start,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if err := d.DB.Gorm.Create(&chapter).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to save chapter", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, chapter)
+
+	redis.InvalidateCache("file:" + c.Param("id"))
+}
+
+// UpdateChapter renames or moves a chapter marker
+func UpdateChapter(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+
+	var req chapterRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Title == nil && req.Start == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid request body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	file, ok := ownedFile(c, d, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	chapter, ok := fileChapter(c, d, file)
+	if !ok {
+		return
+	}
+
+	if req.Title != nil {
+		chapter.Title = strings.TrimSpace(*req.Title)
+	}
+
+	if req.Start != nil {
+		chapter.Start = *req.Start
+	}
+
+	if err := validators.ChapterValidator(chapter.Title, chapter.Start, file.Duration); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	err := d.DB.Gorm.
+		Model(&chapter).
+		Updates(map[string]any{
+			"title": chapter.Title,
+			"start": chapter.Start,
+		}).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update chapter", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, chapter)
+
+	redis.InvalidateCache("file:" + c.Param("id"))
+}
+
+// DeleteChapter removes a chapter marker from a file
+func DeleteChapter(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+
+	file, ok := ownedFile(c, d, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	chapter, ok := fileChapter(c, d, file)
+	if !ok {
+		return
+	}
+
+	if err := d.DB.Gorm.Delete(&chapter).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete chapter", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+
+	redis.InvalidateCache("file:" + c.Param("id"))
+}
+
+// ChaptersVTT returns the chapters of a public file as a WebVTT chapters
+// track. The file is looked up by its key so players can load it the same
+// way they load the video
+func ChaptersVTT(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+
+	var file model.File
+	err := d.DB.Gorm.
+		Where("file_key = ? AND private = ?", c.Param("key"), false).
+		Preload("Chapters", func(tx *gorm.DB) *gorm.DB { return tx.Order("start") }).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+
+	// Every chapter lasts until the next one starts
+	for i, ch := range file.Chapters {
+		end := file.Duration
+		if i+1 < len(file.Chapters) {
+			end = file.Chapters[i+1].Start
+		}
+
+		if end <= ch.Start {
+			continue
+		}
+
+		fmt.Fprintf(&vtt, "\n%d\n%s --> %s\n%s\n", i+1, util.FloatToTimestamp(ch.Start), util.FloatToTimestamp(end), ch.Title)
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.Data(http.StatusOK, "text/vtt; charset=utf-8", []byte(vtt.String()))
+}
+
+// shiftChapters moves the chapters of a file to where they end up after
+// it was processed and drops the ones that were cut out. duration is the
+// length of the video before processing
+func shiftChapters(tx *gorm.DB, fileID uint, opts *validators.ProcessingOptions, duration float64) error {
+	var chapters []model.Chapter
+	if err := tx.Where("file_id = ?", fileID).Find(&chapters).Error; err != nil {
+		return err
+	}
+
+	for _, ch := range chapters {
+		start, ok := service.MapTime(opts, duration, ch.Start)
+		if !ok {
+			if err := tx.Delete(&ch).Error; err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := tx.Model(&ch).Update("start", start).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ownedFile fetches a file of the current user and writes the error
+// response if it can't
+func ownedFile(c *gin.Context, d *types.Dependencies, fileID string) (*model.File, bool) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var file model.File
+	err := d.DB.Gorm.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.String("requestID", requestID), zap.Error(err))
+		return nil, false
+	}
+
+	return &file, true
+}
+
+// fileChapter fetches the chapter from the URL that belongs to the file
+func fileChapter(c *gin.Context, d *types.Dependencies, file *model.File) (model.Chapter, bool) {
+	requestID := c.MustGet("requestID").(string)
+
+	var chapter model.Chapter
+
+	chapterID, err := strconv.Atoi(c.Param("chapterID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid chapter ID provided",
+			"requestID": requestID,
+		})
+		return chapter, false
+	}
+
+	err = d.DB.Gorm.
+		Where("id = ? AND file_id = ?", chapterID, file.ID).
+		First(&chapter).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Chapter not found",
+				"requestID": requestID,
+			})
+			return chapter, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch chapter from db", zap.String("requestID", requestID), zap.Error(err))
+		return chapter, false
+	}
+
+	return chapter, true
+}
@@ -0,0 +1,106 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+type composeRequest struct {
+	Name    string     `json:"name"`
+	Main    concatItem `json:"main" binding:"required"`
+	Overlay concatItem `json:"overlay" binding:"required"`
+	Layout  string     `json:"layout"` // pip (default), side-by-side or stacked
+	Audio   string     `json:"audio"`  // main (default), overlay or mix
+
+	PiPPosition string  `json:"pipPosition"` // top-left, top-right, bottom-left or bottom-right (default)
+	PiPScale    float64 `json:"pipScale"`    // Width relative to the main video
+	PiPMargin   int     `json:"pipMargin"`   // In pixels
+}
+
+var (
+	validLayouts      = []string{"pip", "side-by-side", "stacked"}
+	validComposeAudio = []string{"main", "overlay", "mix"}
+	validPiPPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right"}
+
+	errComposeInvalid  = errors.New("invalid compose options provided")
+	errComposeTrim     = errors.New("invalid trim provided")
+	errComposePiPScale = errors.New("picture-in-picture scale must be between 0.1 and 0.9")
+)
+
+// validate checks the request and fills in defaults
+func (r *composeRequest) validate() error {
+	for _, item := range []concatItem{r.Main, r.Overlay} {
+		if item.TrimStart < 0 || (item.TrimEnd != 0 && item.TrimEnd <= item.TrimStart) {
+			return errComposeTrim
+		}
+	}
+
+	if r.Layout == "" {
+		r.Layout = "pip"
+	}
+
+	if r.Audio == "" {
+		r.Audio = "main"
+	}
+
+	if r.PiPPosition == "" {
+		r.PiPPosition = "bottom-right"
+	}
+
+	if r.PiPScale == 0 {
+		r.PiPScale = 0.3
+	}
+
+	if r.PiPScale < 0.1 || r.PiPScale > 0.9 {
+		return errComposePiPScale
+	}
+
+	if !slices.Contains(validLayouts, r.Layout) ||
+		!slices.Contains(validComposeAudio, r.Audio) ||
+		!slices.Contains(validPiPPositions, r.PiPPosition) ||
+		r.PiPMargin < 0 || r.PiPMargin > 500 {
+		return errComposeInvalid
+	}
+
+	return nil
+}
+
+// Compose puts two of the user's videos into one frame, either as a
+// picture-in-picture or next to each other, and saves it as a new file
+func Compose(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+
+	var req composeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid request body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	items := []concatItem{req.Main, req.Overlay}
+
+	renderNewFile(c, d, items, req.Name, "compose_", nil, func(inputs []service.ConcatInput) ([]string, float64, error) {
+		return service.MakeComposeFlags(inputs[0], inputs[1], service.ComposeOptions{
+			Layout:      req.Layout,
+			PiPPosition: req.PiPPosition,
+			PiPScale:    req.PiPScale,
+			PiPMargin:   req.PiPMargin,
+			Audio:       req.Audio,
+		})
+	})
+}
@@ -0,0 +1,79 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type concatItem struct {
+	ID        uint    `json:"id" binding:"required"`
+	TrimStart float64 `json:"trimStart"`
+	TrimEnd   float64 `json:"trimEnd"` // 0 means until the end of the video
+}
+
+type concatRequest struct {
+	Name      string       `json:"name"`
+	Items     []concatItem `json:"items" binding:"required"`
+	Crossfade float64      `json:"crossfade"` // In seconds, 0 cuts between the videos
+}
+
+const maxConcatItems = 20
+
+func Concat(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+
+	var req concatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid request body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if len(req.Items) < 2 || len(req.Items) > maxConcatItems {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Between 2 and 20 videos have to be provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if req.Crossfade < 0 || req.Crossfade > validators.MaxCrossfadeDuration {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Crossfade must be between 0 and 5 seconds",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	for _, item := range req.Items {
+		if item.TrimStart < 0 || (item.TrimEnd != 0 && item.TrimEnd <= item.TrimStart) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Invalid trim provided",
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
+	var check func(lengths []float64) error
+	if req.Crossfade > 0 {
+		check = func(lengths []float64) error {
+			if err := service.CheckCrossfade(lengths, req.Crossfade); err != nil {
+				return errors.New("Videos are too short for the crossfade")
+			}
+
+			return nil
+		}
+	}
+
+	renderNewFile(c, d, req.Items, req.Name, "concat_", check, func(inputs []service.ConcatInput) ([]string, float64, error) {
+		return service.MakeConcatFlags(inputs, req.Crossfade)
+	})
+}
@@ -3,9 +3,11 @@ package file
 import (
 	"bitwise74/video-api/internal/model"
 	"bitwise74/video-api/internal/redis"
+	"bitwise74/video-api/internal/service"
 	"bitwise74/video-api/internal/types"
 	"context"
 	"net/http"
+	"path"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -16,9 +18,11 @@ import (
 )
 
 type deleteInfo struct {
-	FileKey  string
-	ThumbKey string
-	Size     int
+	FileKey    string
+	ThumbKey   string
+	SpritesKey string
+	PreviewKey string
+	Size       int
 }
 
 type deleteRequest struct {
@@ -51,7 +55,7 @@ func Delete(c *gin.Context, d *types.Dependencies) {
 	err := d.DB.Gorm.
 		Model(model.File{}).
 		Where("user_id = ? AND id IN ?", userID, req.IDs).
-		Select("file_key", "size").
+		Select("file_key", "sprites_key", "preview_key", "size").
 		Find(&info).
 		Error
 	if err != nil {
@@ -89,21 +93,81 @@ func Delete(c *gin.Context, d *types.Dependencies) {
 		return
 	}
 
+	var subs []model.Subtitle
+
+	err = tx.
+		Where("user_id = ? AND file_id IN ?", userID, req.IDs).
+		Find(&subs).
+		Error
+	if err == nil {
+		err = tx.
+			Where("user_id = ? AND file_id IN ?", userID, req.IDs).
+			Delete(model.Subtitle{}).
+			Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+		tx.Rollback()
+
+		zap.L().Error("Failed to delete subtitles", zap.Error(err))
+		return
+	}
+
+	err = tx.
+		Where("user_id = ? AND file_id IN ?", userID, req.IDs).
+		Delete(model.Chapter{}).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+		tx.Rollback()
+
+		zap.L().Error("Failed to delete chapters", zap.Error(err))
+		return
+	}
+
 	// Format deleteInfo into something usable
 	objects := []awsTypes.ObjectIdentifier{}
 	totalSize := 0
 
 	for _, v := range info {
-		thumbKey := strings.TrimSuffix(v.FileKey, ".mp4") + ".webp"
+		objects = append(objects, awsTypes.ObjectIdentifier{Key: &v.FileKey})
+
+		// Animated WebP images are their own thumbnail
+		thumbKey := strings.TrimSuffix(v.FileKey, path.Ext(v.FileKey)) + ".webp"
+		if thumbKey != v.FileKey {
+			objects = append(objects, awsTypes.ObjectIdentifier{Key: &thumbKey})
+		}
+
+		if v.SpritesKey != "" {
+			sheetKey := service.SpriteSheetKey(v.SpritesKey)
 
-		objects = append(objects,
-			awsTypes.ObjectIdentifier{Key: &v.FileKey},
-			awsTypes.ObjectIdentifier{Key: &thumbKey},
-		)
+			objects = append(objects,
+				awsTypes.ObjectIdentifier{Key: &v.SpritesKey},
+				awsTypes.ObjectIdentifier{Key: &sheetKey},
+			)
+		}
+
+		if v.PreviewKey != "" {
+			objects = append(objects, awsTypes.ObjectIdentifier{Key: &v.PreviewKey})
+		}
 
 		totalSize += v.Size
 	}
 
+	for _, sub := range subs {
+		objects = append(objects, awsTypes.ObjectIdentifier{Key: &sub.Key})
+
+		if sub.SourceKey != sub.Key {
+			objects = append(objects, awsTypes.ObjectIdentifier{Key: &sub.SourceKey})
+		}
+	}
+
 	_, err = d.S3.C.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
 		Bucket: d.S3.Bucket,
 		Delete: &awsTypes.Delete{
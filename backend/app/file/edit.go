@@ -8,10 +8,12 @@ import (
 	"bitwise74/video-api/pkg/util"
 	"bitwise74/video-api/pkg/validators"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -100,6 +102,9 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 	}
 
 	originalSize := file.Size
+	originalDuration := file.Duration
+
+	var subtitles []shiftedSubtitle
 
 	if data.ProcessingOptions != nil {
 		if code, err := validators.ProcessingOptsValidator(data.ProcessingOptions, float64(file.Size)); err != nil {
@@ -110,6 +115,14 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 			return
 		}
 
+		if file.Format != "video/mp4" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Only videos can be processed",
+				"requestID": requestID,
+			})
+			return
+		}
+
 		// Download the video to process
 		temp, err := os.CreateTemp("", "process-*.mp4")
 		if err != nil {
@@ -124,7 +137,7 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 		defer temp.Close()
 		defer os.Remove(temp.Name())
 
-		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, os.Getenv("CLOUDFRONT_URL")+"/"+file.FileKey, nil)
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, util.FileURL(file.FileKey), nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":     "Internal server error",
@@ -167,6 +180,185 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 		}
 		temp.Seek(0, 0)
 
+		if id := data.ProcessingOptions.SubtitleTrack; id != 0 {
+			var sub model.Subtitle
+
+			err := d.DB.Gorm.
+				Where("id = ? AND file_id = ? AND user_id = ?", id, file.ID, userID).
+				First(&sub).
+				Error
+			if err != nil {
+				if err == gorm.ErrRecordNotFound {
+					c.JSON(http.StatusNotFound, gin.H{
+						"error":     "Subtitles not found",
+						"requestID": requestID,
+					})
+					return
+				}
+
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to fetch subtitles from db", zap.Error(err))
+				return
+			}
+
+			subPath, err := service.DownloadFile(c.Request.Context(), sub.SourceKey)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to download subtitles", zap.Error(err))
+				return
+			}
+			defer os.Remove(subPath)
+
+			data.ProcessingOptions.SubtitlePath = subPath
+		}
+
+		cleanup, code, err := service.FetchOverlays(c.Request.Context(), d.DB, data.ProcessingOptions, userID)
+		defer cleanup()
+
+		if err != nil {
+			if code == http.StatusInternalServerError {
+				zap.L().Error("Failed to fetch overlays", zap.Error(err))
+
+				err = errors.New("Internal server error")
+			}
+
+			c.JSON(code, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		shift, err := service.AlignToKeyframe(data.ProcessingOptions, temp.Name())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to align trim to a keyframe", zap.Error(err))
+			return
+		}
+
+		// Lets the client know how far the start of a fast trim moved
+		c.Header("X-Trim-Start-Offset", strconv.FormatFloat(shift, 'f', 3, 64))
+
+		removed, err := service.RemoveSilences(c.Request.Context(), data.ProcessingOptions, temp.Name(), userID, d.JobQueue)
+		if errors.Is(err, service.ErrAllSilent) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Removing silence wouldn't leave anything to render",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to detect silence", zap.Error(err))
+			return
+		}
+
+		if data.ProcessingOptions.RemoveSilence {
+			c.Header("X-Silence-Removed", strconv.FormatFloat(removed, 'f', 3, 64))
+		}
+
+		if err := service.CheckBufferedDuration(data.ProcessingOptions, temp.Name()); err != nil {
+			if errors.Is(err, service.ErrTooLongToBuffer) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":     err.Error(),
+					"requestID": requestID,
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to check clip duration", zap.Error(err))
+			return
+		}
+
+		if err := service.AnalyzeMotion(c.Request.Context(), data.ProcessingOptions, temp.Name(), userID, d.JobQueue); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to analyze motion", zap.Error(err))
+			return
+		}
+
+		if data.ProcessingOptions.TransformsPath != "" {
+			defer os.Remove(data.ProcessingOptions.TransformsPath)
+		}
+
+		// Options that don't fit the video are reported here for looped clips as
+		// the clip is rendered before the flags of the output are made
+		if err := service.RenderLoop(c.Request.Context(), data.ProcessingOptions, temp.Name(), userID, d.JobQueue); err != nil {
+			if errors.Is(err, service.ErrInvalidOptions) || errors.Is(err, service.ErrTooLongToBuffer) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":     err.Error(),
+					"requestID": requestID,
+				})
+				return
+			}
+
+			if errors.Is(err, service.ErrJobQueueFull) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"error":     "Job queue is full. Please wait a moment before trying again",
+					"requestID": requestID,
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to render looped clip", zap.Error(err))
+			return
+		}
+
+		if data.ProcessingOptions.LoopPath != "" {
+			defer os.Remove(data.ProcessingOptions.LoopPath)
+		}
+
+		// Flags are made before enqueueing so options that don't fit the video
+		// are reported to the user instead of failing the job
+		args, duration, err := d.JobQueue.MakeFFmpegFlags(data.ProcessingOptions, temp.Name())
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidOptions) || errors.Is(err, service.ErrTooLongToBuffer) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":     err.Error(),
+					"requestID": requestID,
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to prepare FFmpeg job", zap.Error(err))
+			return
+		}
+
 		ctxReq := c.Request.Context()
 		ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Minute*10)
 		defer cancel()
@@ -192,8 +384,8 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 		err = d.JobQueue.Enqueue(&service.FFmpegJob{
 			ID:       util.RandStr(5),
 			UserID:   userID,
-			FilePath: temp.Name(),
-			Opts:     data.ProcessingOptions,
+			Args:     &args,
+			Duration: duration,
 			UseGPU:   true,
 			Output:   tempProcessed,
 			Ctx:      ctx,
@@ -216,6 +408,29 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 			return
 		}
 
+		// Exports in another format are saved as a new file so the
+		// original video is kept
+		if data.ProcessingOptions.ExportFormat != "mp4" {
+			saveExport(c, d, &file, data.ProcessingOptions, tempProcessed.Name())
+			return
+		}
+
+		// Subtitles have to follow the trimmed and cut video like the
+		// chapters. Done before the video is replaced so a failure leaves
+		// the file as it was
+		if data.ProcessingOptions.ChangesTiming() {
+			subtitles, err = shiftSubtitles(c.Request.Context(), d, &file, data.ProcessingOptions, originalDuration)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to shift subtitles", zap.Error(err))
+				return
+			}
+		}
+
 		keyNoExt := strings.TrimSuffix(file.FileKey, path.Ext(file.FileKey))
 
 		newFile, err := d.Uploader.Do(tempProcessed.Name(), file.OriginalName, userID, keyNoExt)
@@ -226,6 +441,7 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 			})
 
 			zap.L().Error("Failed to upload edited video to S3", zap.Error(err))
+			removeShiftedSubtitles(d, subtitles)
 			return
 		}
 
@@ -233,6 +449,8 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 
 		file.Duration = newFile.Duration
 		file.Size = newFile.Size
+		// The thumbnail is captured again from the edited video
+		file.ThumbVersion++
 	}
 
 	file.Version++
@@ -244,6 +462,17 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 				return err
 			}
 
+			// Chapters have to follow the trimmed and cut video
+			if data.ProcessingOptions != nil {
+				if err := shiftChapters(tx, file.ID, data.ProcessingOptions, originalDuration); err != nil {
+					return err
+				}
+			}
+
+			if err := saveShiftedSubtitles(tx, subtitles); err != nil {
+				return err
+			}
+
 			if originalSize != file.Size {
 				err := tx.
 					Model(model.Stats{}).
@@ -266,11 +495,82 @@ func Edit(c *gin.Context, d *types.Dependencies) {
 		})
 
 		zap.L().Error("Failed to commit transaction after file edit", zap.Error(err))
+		removeShiftedSubtitles(d, subtitles)
 		return
 	}
 
+	// The replaced tracks are only deleted once nothing points at them
+	removed := 0
+	for _, s := range subtitles {
+		deleteObjects(d, s.Key, s.SourceKey)
+
+		if s.NewKey == "" {
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		c.Header("X-Subtitles-Removed", strconv.Itoa(removed))
+	}
+
 	c.JSON(http.StatusOK, file)
 
 	redis.InvalidateCache("user:" + userID)
 	redis.InvalidateCache("file:" + fileID)
+
+	// The assets are rendered again from the edited video
+	if data.ProcessingOptions != nil {
+		go d.Assets.Generate(file)
+	}
+}
+
+// saveExport stores the result of an export as a new file next to the
+// edited one
+func saveExport(c *gin.Context, d *types.Dependencies, file *model.File, opts *validators.ProcessingOptions, p string) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	name := strings.TrimSuffix(file.OriginalName, path.Ext(file.OriginalName)) + "." + opts.ExportFormat
+
+	fileEnt, err := d.Uploader.DoAs(p, name, userID, opts.MimeType())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to upload export to S3", zap.Error(err))
+		return
+	}
+
+	fileEnt.Private = file.Private
+
+	err = d.DB.Gorm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&fileEnt).Error; err != nil {
+			return err
+		}
+
+		return tx.
+			Model(model.Stats{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]any{
+				"used_storage":   gorm.Expr("used_storage + ?", fileEnt.Size),
+				"uploaded_files": gorm.Expr("uploaded_files + ?", 1),
+			}).
+			Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Database transaction failed", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, fileEnt)
+
+	redis.InvalidateCache("user:" + userID)
+	redis.InvalidateCache("profile:" + userID)
 }
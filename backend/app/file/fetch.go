@@ -32,6 +32,8 @@ func Fetch(c *gin.Context, d *types.Dependencies) {
 
 	err := d.DB.Gorm.
 		Where("file_key = ? AND private = ?", fileKey, false).
+		Preload("Subtitles").
+		Preload("Chapters", func(tx *gorm.DB) *gorm.DB { return tx.Order("start") }).
 		First(&file).
 		Error
 	if err != nil {
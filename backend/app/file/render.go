@@ -0,0 +1,316 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/redis"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// buildFlags makes the ffmpeg flags from the downloaded videos and returns
+// the duration of the output
+type buildFlags func(inputs []service.ConcatInput) ([]string, float64, error)
+
+// renderNewFile renders the kept parts of the user's videos into one and
+// saves it as a new file. check gets the kept length of every video when
+// all of them are known and returns an error the user can fix. The name is
+// checked like the names of uploads. If it's empty the prefix is put in
+// front of the name of the first video
+func renderNewFile(c *gin.Context, d *types.Dependencies, items []concatItem, name, prefix string, check func(lengths []float64) error, build buildFlags) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+	userDefaultPrivateVideos := c.MustGet("userDefaultPrivateVideos").(bool)
+
+	if name != "" {
+		var err error
+
+		name, err = validators.FileNameValidator(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
+	ids := []uint{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	var files []model.File
+	err := d.DB.Gorm.
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Find(&files).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch files from db", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	byID := map[uint]model.File{}
+	for _, f := range files {
+		byID[f.ID] = f
+	}
+
+	// The output size can't be known beforehand so the kept parts of
+	// the inputs are used as an estimate
+	var estimatedSize int64
+	var lengths []float64
+	for _, item := range items {
+		f, ok := byID[item.ID]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found. It either doesn't exist or you don't own it",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if f.Format != "video/mp4" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Only videos can be used",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		kept := 1.0
+		if f.Duration > 0 {
+			end := f.Duration
+			if item.TrimEnd > 0 {
+				end = min(item.TrimEnd, f.Duration)
+			}
+
+			if end <= item.TrimStart {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":     "Trim start is past the end of the video",
+					"requestID": requestID,
+				})
+				return
+			}
+
+			kept = (end - item.TrimStart) / f.Duration
+			lengths = append(lengths, end-item.TrimStart)
+		}
+
+		estimatedSize += int64(float64(f.Size) * kept)
+	}
+
+	// Durations aren't always known, the job checks them again
+	if check != nil && len(lengths) == len(items) {
+		if err := check(lengths); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
+	ok, err := d.DB.HasStorageFor(userID, estimatedSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check user's storage", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     validators.ErrNoSpace.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	ctxReq := c.Request.Context()
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	ctx, cancelMerged := util.MergeContexts(ctxReq, ctxTimeout)
+	defer cancelMerged()
+
+	// The same video can be used multiple times so it's only downloaded once
+	paths := map[uint]string{}
+	defer func() {
+		for _, p := range paths {
+			os.Remove(p)
+		}
+	}()
+
+	inputs := []service.ConcatInput{}
+	for _, item := range items {
+		p, ok := paths[item.ID]
+		if !ok {
+			p, err = service.DownloadFile(ctx, byID[item.ID].FileKey)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to download video", zap.String("requestID", requestID), zap.Error(err))
+				return
+			}
+
+			paths[item.ID] = p
+		}
+
+		inputs = append(inputs, service.ConcatInput{
+			Path:      p,
+			TrimStart: item.TrimStart,
+			TrimEnd:   item.TrimEnd,
+		})
+	}
+
+	args, duration, err := build(inputs)
+	if err != nil {
+		// Videos with an unknown duration are only checked here
+		if errors.Is(err, service.ErrEmptyInput) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Trim start is past the end of the video",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrInvalidOptions) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to prepare FFmpeg job", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	tempProcessed, err := os.CreateTemp("", "processed-*.mp4")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to create processed file", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer tempProcessed.Close()
+	defer os.Remove(tempProcessed.Name())
+
+	done := make(chan error, 1)
+	err = d.JobQueue.Enqueue(&service.FFmpegJob{
+		ID:       util.RandStr(5),
+		UserID:   userID,
+		Output:   tempProcessed,
+		UseGPU:   true,
+		Args:     &args,
+		Duration: duration,
+		Ctx:      ctx,
+		Done:     done,
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":     "Job queue is full. Please wait a moment before trying again",
+			"requestID": requestID,
+		})
+
+		zap.L().Warn("Failed to enqueue FFmpeg job", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+			return
+		}
+	case <-ctx.Done():
+		c.JSON(http.StatusRequestTimeout, gin.H{
+			"error":     "Request was cancelled or timed out",
+			"requestID": requestID,
+		})
+
+		zap.L().Warn("Request context done before FFmpeg finished", zap.Error(ctx.Err()))
+		return
+	}
+
+	// The prefix can push a long name over the limit
+	if name == "" {
+		name = validators.SanitizeFileName(prefix + byID[items[0].ID].OriginalName)
+	}
+
+	fileEnt, err := d.Uploader.Do(tempProcessed.Name(), name, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to upload video to S3", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	fileEnt.Private = userDefaultPrivateVideos
+
+	err = d.DB.Gorm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&fileEnt).Error; err != nil {
+			return err
+		}
+
+		return tx.
+			Model(model.Stats{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]any{
+				"used_storage":   gorm.Expr("used_storage + ?", fileEnt.Size),
+				"uploaded_files": gorm.Expr("uploaded_files + ?", 1),
+			}).
+			Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Database transaction failed", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, fileEnt)
+
+	redis.InvalidateCache("user:" + userID)
+	redis.InvalidateCache("profile:" + userID)
+
+	go d.Assets.Generate(*fileEnt)
+}
@@ -0,0 +1,389 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/redis"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// UploadSubtitle stores a new subtitle track for a file. The original file
+// is kept for burning in and a WebVTT copy is made for the player
+func UploadSubtitle(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	language := c.PostForm("language")
+	label := c.DefaultPostForm("label", language)
+
+	format, err := validators.SubtitleValidator(fh, language, label)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var file model.File
+	err = d.DB.Gorm.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	ext := strings.ToLower(path.Ext(fh.Filename))
+
+	source, err := os.CreateTemp("", "subtitles-*"+ext)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to create temporary file", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer source.Close()
+	defer os.Remove(source.Name())
+
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to read uploaded file", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(source, f); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to copy data to temporary file", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	vttPath, err := service.ConvertToWebVTT(c.Request.Context(), source.Name(), format, userID, d.JobQueue)
+	if errors.Is(err, service.ErrJobQueueFull) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":     "Job queue is full. Please wait a moment before trying again",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Failed to read subtitle file",
+			"requestID": requestID,
+		})
+
+		zap.L().Warn("Failed to convert subtitles", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer os.Remove(vttPath)
+
+	vtt, err := os.Open(vttPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to open converted subtitles", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer vtt.Close()
+
+	base := "subtitles/" + strings.TrimSuffix(file.FileKey, path.Ext(file.FileKey)) + "-" + util.RandStr(6)
+
+	sub := model.Subtitle{
+		FileID:    file.ID,
+		UserID:    userID,
+		Language:  language,
+		Label:     label,
+		Key:       base + ".vtt",
+		SourceKey: base + ".vtt",
+		CreatedAt: time.Now().Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	_, err = d.S3.C.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       d.S3.Bucket,
+		Key:          aws.String(sub.Key),
+		Body:         vtt,
+		CacheControl: aws.String("public, max-age=3600, stale-while-revalidate=60"),
+		ContentType:  aws.String("text/vtt"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to upload subtitles to S3", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	// WebVTT uploads are already usable by both the player and ffmpeg
+	if ext != ".vtt" {
+		sub.SourceKey = base + ext
+		source.Seek(0, 0)
+
+		_, err = d.S3.C.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      d.S3.Bucket,
+			Key:         aws.String(sub.SourceKey),
+			Body:        source,
+			ContentType: aws.String("text/plain"),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to upload original subtitles to S3", zap.String("requestID", requestID), zap.Error(err))
+			deleteObjects(d, sub.Key)
+			return
+		}
+	}
+
+	if err := d.DB.Gorm.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to save subtitles", zap.String("requestID", requestID), zap.Error(err))
+		deleteObjects(d, sub.Key, sub.SourceKey)
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+
+	redis.InvalidateCache("file:" + fileID)
+}
+
+// DeleteSubtitle removes a subtitle track from a file
+func DeleteSubtitle(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+
+	subID, err := strconv.Atoi(c.Param("subID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid subtitle ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var sub model.Subtitle
+	err = d.DB.Gorm.
+		Where("id = ? AND file_id = ? AND user_id = ?", subID, fileID, userID).
+		First(&sub).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Subtitles not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch subtitles from db", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	if err := d.DB.Gorm.Delete(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete subtitles", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	deleteObjects(d, sub.Key, sub.SourceKey)
+
+	c.Status(http.StatusNoContent)
+
+	redis.InvalidateCache("file:" + fileID)
+}
+
+// deleteObjects removes objects from S3 on a best effort basis
+func deleteObjects(d *types.Dependencies, keys ...string) {
+	seen := map[string]bool{}
+
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		_, err := d.S3.C.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: d.S3.Bucket,
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			zap.L().Error("Failed to delete object from S3", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// shiftedSubtitle is a stored subtitle track and the key of its copy with
+// the cues moved. The key is empty if every cue was cut out
+type shiftedSubtitle struct {
+	model.Subtitle
+	NewKey string
+}
+
+// shiftSubtitles uploads copies of the subtitle tracks of a file with their
+// cues moved to where they end up after processing. The originals can't be
+// shifted without losing their styling so the copy replaces both of them.
+// duration is the length of the video before processing
+func shiftSubtitles(ctx context.Context, d *types.Dependencies, file *model.File, opts *validators.ProcessingOptions, duration float64) ([]shiftedSubtitle, error) {
+	var subs []model.Subtitle
+	if err := d.DB.Gorm.Where("file_id = ?", file.ID).Find(&subs).Error; err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	shifted := []shiftedSubtitle{}
+	for _, sub := range subs {
+		p, err := service.DownloadFile(ctx, sub.Key)
+		if err != nil {
+			removeShiftedSubtitles(d, shifted)
+			return nil, err
+		}
+
+		vtt, err := os.ReadFile(p)
+		os.Remove(p)
+		if err != nil {
+			removeShiftedSubtitles(d, shifted)
+			return nil, err
+		}
+
+		out, n := service.ShiftCues(string(vtt), opts, duration)
+		if n == 0 {
+			shifted = append(shifted, shiftedSubtitle{Subtitle: sub})
+			continue
+		}
+
+		key := "subtitles/" + strings.TrimSuffix(file.FileKey, path.Ext(file.FileKey)) + "-" + util.RandStr(6) + ".vtt"
+
+		_, err = d.S3.C.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:       d.S3.Bucket,
+			Key:          aws.String(key),
+			Body:         strings.NewReader(out),
+			CacheControl: aws.String("public, max-age=3600, stale-while-revalidate=60"),
+			ContentType:  aws.String("text/vtt"),
+		})
+		if err != nil {
+			removeShiftedSubtitles(d, shifted)
+			return nil, err
+		}
+
+		shifted = append(shifted, shiftedSubtitle{Subtitle: sub, NewKey: key})
+	}
+
+	return shifted, nil
+}
+
+// saveShiftedSubtitles points the tracks at their shifted copies and deletes
+// the ones that have no cues left
+func saveShiftedSubtitles(tx *gorm.DB, shifted []shiftedSubtitle) error {
+	for _, s := range shifted {
+		if s.NewKey == "" {
+			if err := tx.Delete(&s.Subtitle).Error; err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err := tx.
+			Model(&s.Subtitle).
+			Updates(map[string]any{
+				"key":        s.NewKey,
+				"source_key": s.NewKey,
+			}).
+			Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeShiftedSubtitles deletes the copies made by shiftSubtitles when they
+// won't be used
+func removeShiftedSubtitles(d *types.Dependencies, shifted []shiftedSubtitle) {
+	for _, s := range shifted {
+		deleteObjects(d, s.NewKey)
+	}
+}
@@ -0,0 +1,219 @@
+package file
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/redis"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// UpdateThumbnail replaces the thumbnail of a file with either the frame at
+// the provided timestamp or an uploaded image
+func UpdateThumbnail(c *gin.Context, d *types.Dependencies) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+
+	timestampStr := c.PostForm("timestamp")
+	image, _ := c.FormFile("image")
+
+	if (timestampStr == "") == (image == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Provide either a timestamp or an image",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var file model.File
+	err := d.DB.Gorm.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	thumbKey := strings.TrimSuffix(file.FileKey, path.Ext(file.FileKey)) + ".webp"
+
+	// Animated WebP images are their own thumbnail
+	if thumbKey == file.FileKey {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "This file can't have a custom thumbnail",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var thumbPath string
+
+	if image != nil {
+		if err := validators.ThumbnailImageValidator(image); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		thumbPath, err = processThumbnailImage(image)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to process thumbnail image", zap.String("requestID", requestID), zap.Error(err))
+			return
+		}
+	} else {
+		timestamp, err := strconv.ParseFloat(timestampStr, 64)
+		if err != nil || math.IsNaN(timestamp) || math.IsInf(timestamp, 0) || timestamp < 0 || (file.Duration > 0 && timestamp >= file.Duration) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Invalid timestamp provided",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if strings.HasPrefix(file.Format, "audio/") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Audio files have no frames to capture",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		videoPath, err := service.DownloadFile(c.Request.Context(), file.FileKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to download video", zap.String("requestID", requestID), zap.Error(err))
+			return
+		}
+		defer os.Remove(videoPath)
+
+		thumbPath, err = service.CaptureFrame(videoPath, timestamp, userID, d.JobQueue)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to capture thumbnail", zap.String("requestID", requestID), zap.Error(err))
+			return
+		}
+	}
+	defer os.Remove(thumbPath)
+
+	thumbFile, err := os.Open(thumbPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to open thumbnail file", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+	defer thumbFile.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	_, err = d.S3.C.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       d.S3.Bucket,
+		Key:          aws.String(thumbKey),
+		Body:         thumbFile,
+		CacheControl: aws.String("public, max-age=86400, stale-while-revalidate=3600"),
+		ContentType:  aws.String("image/webp"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to upload thumbnail to S3", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	err = d.DB.Gorm.
+		Model(&file).
+		Update("thumb_version", gorm.Expr("thumb_version + 1")).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update thumbnail version", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"thumb_version": file.ThumbVersion + 1,
+	})
+
+	redis.InvalidateCache("user:" + userID)
+	redis.InvalidateCache("file:" + fileID)
+}
+
+// processThumbnailImage converts an uploaded thumbnail with vips. The
+// returned file has to be removed by the caller
+func processThumbnailImage(fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	temp, err := os.CreateTemp("", "thumbnail-og-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	if _, err := io.Copy(temp, f); err != nil {
+		return "", err
+	}
+
+	return service.ResizeThumbnail(temp.Name())
+}
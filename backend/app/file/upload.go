@@ -13,6 +13,8 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -91,13 +93,72 @@ func Upload(c *gin.Context, d *types.Dependencies) {
 	defer tempProcessed.Close()
 	defer os.Remove(tempProcessed.Name())
 
+	video, err := service.GetVideoStream(temp.Name())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to probe video stream", zap.String("requestID", requestID), zap.Error(err))
+		return
+	}
+
+	// Phones store the orientation as metadata that a lot of players ignore,
+	// so such videos get re-encoded upright instead
+	rotation := video.Rotation()
+
+	// HDR looks washed out on most screens and after the libx264 transcode
+	// so it's tone mapped to SDR unless the user wants to keep it
+	keepHDR, _ := strconv.ParseBool(c.PostForm("keepHDR"))
+	tonemap := video.IsHDR() && !keepHDR
+
+	// Letterboxed videos can get their black bars removed right away
+	var crop *service.CropRect
+
+	if autoCrop, _ := strconv.ParseBool(c.PostForm("autoCrop")); autoCrop {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute*5)
+		crop, err = service.DetectCrop(ctx, temp.Name(), userID, d.JobQueue)
+		cancel()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to detect black bars", zap.String("requestID", requestID), zap.Error(err))
+			return
+		}
+	}
+
 	var ffmpegOpts []string
 	var useGPU bool
 
-	if path.Ext(fh.Filename) == ".mkv" {
+	if path.Ext(fh.Filename) == ".mkv" || rotation != 0 || crop != nil || tonemap {
 		ffmpegOpts = append(ffmpegOpts,
 			"-y",
 			"-i", temp.Name(),
+		)
+
+		filters := []string{}
+		if crop != nil {
+			filters = append(filters, fmt.Sprintf("crop=%d:%d:%d:%d", crop.CropW, crop.CropH, crop.CropX, crop.CropY))
+		}
+
+		if tonemap {
+			filters = append(filters, service.TonemapFilters(video)...)
+			ffmpegOpts = append(ffmpegOpts, service.SDRColorFlags()...)
+		} else if video.IsHDR() {
+			ffmpegOpts = append(ffmpegOpts, service.HDRColorFlags(video)...)
+		}
+
+		if len(filters) > 0 {
+			ffmpegOpts = append(ffmpegOpts, "-vf", strings.Join(filters, ","))
+		}
+
+		ffmpegOpts = append(ffmpegOpts,
+			"-metadata:s:v:0", "rotate=0",
 			"-movflags", "+faststart",
 			"-f", "mp4",
 			tempProcessed.Name(),
@@ -201,4 +262,6 @@ func Upload(c *gin.Context, d *types.Dependencies) {
 	c.JSON(http.StatusOK, fileEnt)
 
 	redis.InvalidateCache("user:" + userID)
+
+	go d.Assets.Generate(*fileEnt)
 }
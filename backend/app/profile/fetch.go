@@ -3,6 +3,7 @@ package profile
 import (
 	"bitwise74/video-api/internal/model"
 	"bitwise74/video-api/internal/types"
+	"bitwise74/video-api/pkg/util"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -25,6 +26,9 @@ type partialVideo struct {
 	Size         int64   `json:"size"`
 	Format       string  `json:"format"`
 	Version      int     `json:"version"`
+	ThumbVersion int     `json:"thumb_version"`
+	PreviewKey   string  `json:"-"`
+	PreviewURL   string  `gorm:"-" json:"preview_url,omitempty"`
 }
 
 type ProfileResponse struct {
@@ -83,7 +87,7 @@ func Fetch(c *gin.Context, d *types.Dependencies) {
 	err = d.DB.Gorm.
 		Model(model.File{}).
 		Where("private = ? AND user_id = ?", false, prof.ID).
-		Select("file_key", "original_name", "duration", "created_at", "size", "format", "version").
+		Select("file_key", "original_name", "duration", "created_at", "size", "format", "version", "thumb_version", "preview_key").
 		Order("created_at DESC").
 		Limit(25).
 		Find(&videos).
@@ -98,6 +102,12 @@ func Fetch(c *gin.Context, d *types.Dependencies) {
 		return
 	}
 
+	for i, v := range videos {
+		if v.PreviewKey != "" {
+			videos[i].PreviewURL = util.FileURL(v.PreviewKey)
+		}
+	}
+
 	data := ProfileResponse{
 		Username:   prof.Username,
 		AvatarHash: prof.AvatarHash,
@@ -43,7 +43,7 @@ func NewRouter() (*gin.Engine, error) {
 			AllowOrigins:     origins,
 			AllowMethods:     []string{"GET", "POST", "PATCH", "PUT", "DELETE", "OPTIONS"},
 			AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "TurnstileToken", "Range", "Access-Control-Allow-Headers", "auth_token"},
-			ExposeHeaders:    []string{"Content-Length", "Content-Range"},
+			ExposeHeaders:    []string{"Content-Length", "Content-Range", "X-Trim-Start-Offset", "X-Silence-Removed"},
 			AllowCredentials: true,
 			MaxAge:           12 * time.Hour,
 		}),
@@ -132,9 +132,48 @@ func NewRouter() (*gin.Engine, error) {
 		// POST /api/files         	-> Uploads a new file and stores it in the database
 		ff.POST("", jwt, bodySizeLimiter, func(c *gin.Context) { file.Upload(c, d) })
 
+		// POST /api/files/concat	-> Joins multiple files into a new one
+		ff.POST("/concat", jwt, func(c *gin.Context) { file.Concat(c, d) })
+
+		// POST /api/files/compose	-> Puts two videos into one frame and saves it as a new file
+		ff.POST("/compose", jwt, func(c *gin.Context) { file.Compose(c, d) })
+
 		// PATCH /api/files/:id		-> Updates a file
 		ff.PATCH("/:id", jwt, func(c *gin.Context) { file.Edit(c, d) })
 
+		// POST /api/files/:id/subtitles	-> Adds a subtitle track to a file
+		ff.POST("/:id/subtitles", jwt, func(c *gin.Context) { file.UploadSubtitle(c, d) })
+
+		// GET /api/files/:id/analyze/silence	-> Returns the silent parts of a file
+		ff.GET("/:id/analyze/silence", jwt, func(c *gin.Context) { file.AnalyzeSilence(c, d) })
+
+		// GET /api/files/:id/adjust/preview	-> Renders a single frame with color adjustments applied
+		ff.GET("/:id/adjust/preview", jwt, func(c *gin.Context) { file.PreviewAdjustments(c, d) })
+
+		// GET /api/files/:id/analyze/crop	-> Suggests a crop that removes black bars
+		ff.GET("/:id/analyze/crop", jwt, func(c *gin.Context) { file.AnalyzeCrop(c, d) })
+
+		// POST /api/files/:id/thumbnail	-> Replaces the thumbnail of a file
+		ff.POST("/:id/thumbnail", jwt, func(c *gin.Context) { file.UpdateThumbnail(c, d) })
+
+		// GET /api/files/key/:key/chapters.vtt	-> Returns the chapters of a public file as WebVTT
+		ff.GET("/key/:key/chapters.vtt", func(c *gin.Context) { file.ChaptersVTT(c, d) })
+
+		// GET /api/files/:id/chapters/detect	-> Proposes chapters from scene changes
+		ff.GET("/:id/chapters/detect", jwt, func(c *gin.Context) { file.DetectChapters(c, d) })
+
+		// POST /api/files/:id/chapters	-> Adds a chapter marker to a file
+		ff.POST("/:id/chapters", jwt, func(c *gin.Context) { file.CreateChapter(c, d) })
+
+		// PATCH /api/files/:id/chapters/:chapterID	-> Renames or moves a chapter marker
+		ff.PATCH("/:id/chapters/:chapterID", jwt, func(c *gin.Context) { file.UpdateChapter(c, d) })
+
+		// DELETE /api/files/:id/chapters/:chapterID	-> Deletes a chapter marker
+		ff.DELETE("/:id/chapters/:chapterID", jwt, func(c *gin.Context) { file.DeleteChapter(c, d) })
+
+		// DELETE /api/files/:id/subtitles/:subID	-> Deletes a subtitle track
+		ff.DELETE("/:id/subtitles/:subID", jwt, func(c *gin.Context) { file.DeleteSubtitle(c, d) })
+
 		// DELETE /api/files/		-> Deletes multiple files
 		ff.DELETE("", jwt, func(c *gin.Context) { file.Delete(c, d) })
 
@@ -147,6 +186,9 @@ func NewRouter() (*gin.Engine, error) {
 		// GET /api/ffmpeg/start	-> Starts an FFmpeg job
 		f.GET("/start", func(c *gin.Context) { ffmpeg.Start(c, d) })
 
+		// GET /api/ffmpeg/features	-> Lists the options supported by the local ffmpeg
+		f.GET("/features", ffmpeg.Features)
+
 		// GET /api/ffmpeg/progress	-> Returns the progress of a job
 		f.POST("/process", bodySizeLimiter, func(c *gin.Context) { ffmpeg.Process(c, d) })
 
@@ -172,6 +214,7 @@ func NewRouter() (*gin.Engine, error) {
 
 	d.S3 = s3
 	d.Uploader = service.NewUploader(d.JobQueue, s3)
+	d.Assets = service.NewAssetGenerator(db.Gorm, d.JobQueue, s3)
 
 	// Start FFmpeg job queue
 	d.JobQueue.StartWorkerPool()
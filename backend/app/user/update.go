@@ -193,6 +193,52 @@ func Update(c *gin.Context, d *types.Dependencies) {
 		user.AvatarHash = key
 	}
 
+	if data.Watermark != nil {
+		fh, err := data.Watermark.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to read uploaded file", zap.String("requestID", requestID), zap.Error(err))
+			return
+		}
+		defer fh.Close()
+
+		key := util.RandStr(32) + ".png"
+
+		// Stored next to the avatars
+		_, err = d.S3.C.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:       d.S3.Bucket,
+			Key:          aws.String("watermarks/" + key),
+			Body:         fh,
+			CacheControl: aws.String("public, max-age=14400"),
+			ContentType:  aws.String("image/png"),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to upload watermark", zap.String("requestID", requestID), zap.Error(err))
+			return
+		}
+
+		if user.WatermarkHash != "" {
+			_, err = d.S3.C.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+				Bucket: d.S3.Bucket,
+				Key:    aws.String("watermarks/" + user.WatermarkHash),
+			})
+			if err != nil {
+				zap.L().Error("Failed to delete old watermark", zap.String("requestID", requestID), zap.Error(err))
+			}
+		}
+
+		user.WatermarkHash = key
+	}
+
 	if data.PublicProfileEnabled != nil {
 		user.PublicProfileEnabled = *data.PublicProfileEnabled
 	}
@@ -202,6 +248,7 @@ func Update(c *gin.Context, d *types.Dependencies) {
 		Where("id = ?", userID).
 		Updates(map[string]any{
 			"avatar_hash":            gorm.Expr("?", user.AvatarHash),
+			"watermark_hash":         gorm.Expr("?", user.WatermarkHash),
 			"username":               gorm.Expr("?", user.Username),
 			"public_profile_enabled": gorm.Expr("?", user.PublicProfileEnabled),
 			"default_private_videos": gorm.Expr("?", data.DefaultPrivateVideos),
@@ -217,8 +264,9 @@ func Update(c *gin.Context, d *types.Dependencies) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"username":   user.Username,
-		"avatarHash": user.AvatarHash,
+		"username":      user.Username,
+		"avatarHash":    user.AvatarHash,
+		"watermarkHash": user.WatermarkHash,
 	})
 
 	redis.InvalidateCache("user:" + userID)
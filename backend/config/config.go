@@ -12,6 +12,7 @@ import (
 	"os/exec"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -137,6 +138,33 @@ func Setup() error {
 		}
 	}
 
+	// Stabilization and tone mapping need filters that aren't part of every build
+	out, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list ffmpeg filters, %w", err)
+	}
+
+	filters := string(out)
+
+	switch {
+	case strings.Contains(filters, " vidstabdetect ") && strings.Contains(filters, " vidstabtransform "):
+		os.Setenv("FFMPEG_STABILIZER", "vidstab")
+	case strings.Contains(filters, " deshake "):
+		os.Setenv("FFMPEG_STABILIZER", "deshake")
+	default:
+		os.Setenv("FFMPEG_STABILIZER", "")
+		zap.L().Warn("FFmpeg has neither vidstab nor deshake, stabilization is disabled")
+	}
+
+	zap.L().Debug("Detected stabilizer", zap.String("filter", os.Getenv("FFMPEG_STABILIZER")))
+
+	if strings.Contains(filters, " zscale ") && strings.Contains(filters, " tonemap ") {
+		os.Setenv("FFMPEG_TONEMAPPER", "zscale")
+	} else {
+		os.Setenv("FFMPEG_TONEMAPPER", "scale")
+		zap.L().Warn("FFmpeg has no zscale filter, HDR videos will only get their color matrix converted")
+	}
+
 	if os.Getenv("FFMPEG_USE_GPU") == "true" {
 		gpu, err := util.DetectGPU()
 		if err != nil {
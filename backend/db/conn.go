@@ -38,7 +38,7 @@ func New() (*DB, error) {
 		return nil, fmt.Errorf("failed to initialize SQLite database, %w", err)
 	}
 
-	err = db.AutoMigrate(model.User{}, model.File{}, model.Stats{}, model.Migration{}, model.Token{})
+	err = db.AutoMigrate(model.User{}, model.File{}, model.Stats{}, model.Migration{}, model.Token{}, model.Subtitle{}, model.Chapter{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to automigrate tables, %w", err)
 	}
@@ -17,3 +17,39 @@ func (d *DB) CheckFileOwnership(userID, fileKey string) (bool, error) {
 
 	return owns, nil
 }
+
+// HasStorageFor checks if a user has enough free storage left to store
+// a file of the provided size
+func (d *DB) HasStorageFor(userID string, size int64) (bool, error) {
+	var stats model.Stats
+
+	err := d.Gorm.
+		Model(model.Stats{}).
+		Where("user_id = ?", userID).
+		Select("used_storage", "max_storage").
+		First(&stats).
+		Error
+	if err != nil {
+		return false, err
+	}
+
+	return stats.UsedStorage+size <= stats.MaxStorage, nil
+}
+
+// FetchAudioKey returns the key of one of the user's audio files. Empty if
+// the file doesn't exist, isn't owned by the user or isn't audio
+func (d *DB) FetchAudioKey(userID string, id uint) (string, error) {
+	var key *string
+
+	err := d.Gorm.
+		Model(model.File{}).
+		Where("id = ? AND user_id = ? AND format LIKE ?", id, userID, "audio/%").
+		Select("file_key").
+		Scan(&key).
+		Error
+	if err != nil || key == nil {
+		return "", err
+	}
+
+	return *key, nil
+}
@@ -74,7 +74,7 @@ func (d *DB) FetchUserDataByID(id string) (*model.User, error) {
 
 	err := d.Gorm.
 		Where("id = ?", id).
-		Select("id", "username", "avatar_hash", "public_profile_enabled", "default_private_videos").
+		Select("id", "username", "avatar_hash", "watermark_hash", "public_profile_enabled", "default_private_videos").
 		Preload("Files", func(db *gorm.DB) *gorm.DB {
 			return db.Limit(10).Order("created_at DESC")
 		}).
@@ -139,3 +139,21 @@ func (d *DB) CheckIfUsernameTaken(username string) (bool, error) {
 
 	return count > 0, nil
 }
+
+// FetchWatermarkHash returns the key of a user's watermark image. It's empty
+// if the user never uploaded one
+func (d *DB) FetchWatermarkHash(userID string) (string, error) {
+	var hash *string
+
+	err := d.Gorm.
+		Model(&model.User{}).
+		Where("id = ?", userID).
+		Select("watermark_hash").
+		Scan(&hash).
+		Error
+	if err != nil || hash == nil {
+		return "", err
+	}
+
+	return *hash, nil
+}
@@ -0,0 +1,10 @@
+package model
+
+type Chapter struct {
+	ID        uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID    uint    `gorm:"index" json:"-"`
+	UserID    string  `json:"-"`
+	Title     string  `json:"title"`
+	Start     float64 `json:"start"` // In seconds
+	CreatedAt int64   `gorm:"not null" json:"created_at"`
+}
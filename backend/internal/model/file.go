@@ -1,6 +1,12 @@
 // Package model defines database models
 package model
 
+import (
+	"bitwise74/video-api/pkg/util"
+
+	"gorm.io/gorm"
+)
+
 type File struct {
 	ID      uint   `gorm:"primaryKey;autoIncrement;index" json:"id"`
 	UserID  string `json:"-"`
@@ -10,11 +16,32 @@ type File struct {
 	Private      bool   `json:"private"`
 	Format       string `json:"format"`
 	// Views        int32       `json:"views"` // TODO: drop
-	Size      int64       `json:"size"`
-	Tags      StringSlice `json:"tags"`
-	State     string      `json:"state"` // Used to inform the frontend/backend if the file is being processed/uploaded
-	Version   int         `gorm:"default:1" json:"version"`
-	Duration  float64     `json:"duration"` // All are unix millisecond timestamps
-	CreatedAt int64       `gorm:"not null" json:"created_at"`
-	ExpiresAt *int64      `json:"expires_at,omitzero"`
+	Size         int64       `json:"size"`
+	Tags         StringSlice `json:"tags"`
+	State        string      `json:"state"` // Used to inform the frontend/backend if the file is being processed/uploaded
+	Version      int         `gorm:"default:1" json:"version"`
+	ThumbVersion int         `gorm:"default:1" json:"thumb_version"` // Bumped when the thumbnail changes to bust caches
+	Duration     float64     `json:"duration"`                       // All are unix millisecond timestamps
+	CreatedAt    int64       `gorm:"not null" json:"created_at"`
+	ExpiresAt    *int64      `json:"expires_at,omitzero"`
+	SpritesKey   string      `gorm:"default:null" json:"-"`
+	SpritesURL   string      `gorm:"-" json:"sprites_url,omitempty"` // WebVTT file of the timeline previews
+	PreviewKey   string      `gorm:"default:null" json:"-"`
+	PreviewURL   string      `gorm:"-" json:"preview_url,omitempty"` // Muted clip shown when hovering over the video
+
+	Subtitles []Subtitle `gorm:"foreignKey:FileID" json:"subtitles,omitempty"`
+	Chapters  []Chapter  `gorm:"foreignKey:FileID" json:"chapters,omitempty"`
+}
+
+// AfterFind fills in the URLs that are built from stored keys
+func (f *File) AfterFind(tx *gorm.DB) error {
+	if f.PreviewKey != "" {
+		f.PreviewURL = util.FileURL(f.PreviewKey)
+	}
+
+	if f.SpritesKey != "" {
+		f.SpritesURL = util.FileURL(f.SpritesKey)
+	}
+
+	return nil
 }
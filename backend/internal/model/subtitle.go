@@ -0,0 +1,12 @@
+package model
+
+type Subtitle struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID    uint   `gorm:"index" json:"-"`
+	UserID    string `json:"-"`
+	Language  string `json:"language"`
+	Label     string `json:"label"`
+	Key       string `json:"key"` // WebVTT version served to the player
+	SourceKey string `json:"-"`   // Original upload, used when burning in to keep styling
+	CreatedAt int64  `gorm:"not null" json:"created_at"`
+}
@@ -25,6 +25,7 @@ type User struct {
 	DeletedAt gorm.DeletedAt `json:"-"`
 
 	AvatarHash           string `gorm:"default:null" json:"avatarHash"`
+	WatermarkHash        string `gorm:"default:null" json:"watermarkHash"`
 	Username             string `gorm:"default:null;unique" json:"username"`
 	PublicProfileEnabled bool   `gorm:"default:false" json:"publicProfileEnabled"`
 	DefaultPrivateVideos bool   `gorm:"default:true" json:"defaultPrivateVideos"`
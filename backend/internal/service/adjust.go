@@ -0,0 +1,59 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// adjustFilters returns the filters that apply the color and detail
+// adjustments. Noise is removed first so sharpening doesn't make it worse
+func adjustFilters(a *validators.Adjustments) []string {
+	filters := []string{}
+
+	if a.Denoise > 0 {
+		// The other hqdn3d strengths are derived from the spatial luma one
+		filters = append(filters, fmt.Sprintf("hqdn3d=%.2f", a.Denoise))
+	}
+
+	eq := []string{}
+	if a.Brightness != 0 {
+		eq = append(eq, fmt.Sprintf("brightness=%.3f", a.Brightness))
+	}
+
+	if a.Contrast != nil && *a.Contrast != 1 {
+		eq = append(eq, fmt.Sprintf("contrast=%.3f", *a.Contrast))
+	}
+
+	if a.Saturation != nil && *a.Saturation != 1 {
+		eq = append(eq, fmt.Sprintf("saturation=%.3f", *a.Saturation))
+	}
+
+	if a.Gamma != nil && *a.Gamma != 1 {
+		eq = append(eq, fmt.Sprintf("gamma=%.3f", *a.Gamma))
+	}
+
+	if len(eq) > 0 {
+		filters = append(filters, "eq="+strings.Join(eq, ":"))
+	}
+
+	if a.Sharpen > 0 {
+		filters = append(filters, fmt.Sprintf("unsharp=5:5:%.2f:5:5:0", a.Sharpen))
+	}
+
+	return filters
+}
+
+// PreviewAdjustments captures the frame at t of the stored video with the
+// adjustments applied so they can be checked before rendering the whole
+// video. FFmpeg seeks in the video over HTTP so only the part around t is
+// fetched
+func PreviewAdjustments(ctx context.Context, key string, t float64, a *validators.Adjustments, userID string, j *JobQueue) (p string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	return captureFrame(ctx, util.FileURL(key), t, userID, j, adjustFilters(a)...)
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"fmt"
+	"strconv"
+)
+
+// addAnimationFilters scales the video down to the export size and frame
+// rate. GIFs are limited to 256 colors so a palette is generated from the
+// clip first, which looks a lot better than the default one
+func addAnimationFilters(g *filterGraph, opts *validators.ProcessingOptions) {
+	g.video = append(g.video,
+		fmt.Sprintf("fps=%.3f", opts.ExportFPS),
+		fmt.Sprintf("scale=%d:-2:flags=lanczos", opts.ExportWidth),
+	)
+
+	if opts.ExportFormat != "gif" {
+		return
+	}
+
+	video := g.flushVideo()
+	frames, sample, palette := g.label("gf"), g.label("gs"), g.label("gp")
+
+	g.chains = append(g.chains,
+		chain([]string{video}, []string{"split"}, frames, sample),
+		chain([]string{sample}, []string{"palettegen=stats_mode=diff"}, palette),
+	)
+
+	g.videoIn = []string{frames, palette}
+	g.video = []string{"paletteuse=dither=bayer:bayer_scale=5:diff_mode=rectangle"}
+}
+
+// animationOutputFlags makes ffmpeg write the animated image to stdout and
+// its progress to stderr
+func animationOutputFlags(opts *validators.ProcessingOptions) []string {
+	args := []string{}
+
+	if opts.ExportFormat == "gif" {
+		// GIFs count the extra plays and use -1 for playing only once
+		loop := 0
+		switch {
+		case opts.ExportLoop == 1:
+			loop = -1
+		case opts.ExportLoop > 1:
+			loop = opts.ExportLoop - 1
+		}
+
+		args = append(args, "-loop", strconv.Itoa(loop), "-f", "gif")
+	} else {
+		args = append(args,
+			"-c:v", "libwebp_anim",
+			"-q:v", "70",
+			"-compression_level", "4",
+			"-loop", strconv.Itoa(opts.ExportLoop),
+			"-f", "webp",
+		)
+	}
+
+	return append(args, pipeFlags()...)
+}
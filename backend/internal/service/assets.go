@@ -0,0 +1,200 @@
+package service
+
+import (
+	a "bitwise74/video-api/aws"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/redis"
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AssetGenerator renders the extra files of a video, like the timeline
+// sprites and hover preview, in the background once it's uploaded or edited
+type AssetGenerator struct {
+	DB       *gorm.DB
+	S3       *a.S3Client
+	JobQueue *JobQueue
+}
+
+func NewAssetGenerator(db *gorm.DB, j *JobQueue, s *a.S3Client) *AssetGenerator {
+	return &AssetGenerator{
+		DB:       db,
+		S3:       s,
+		JobQueue: j,
+	}
+}
+
+// Generate renders every asset of a file. Failures are only logged as the
+// video is usable without them. Meant to be run in its own goroutine
+func (g *AssetGenerator) Generate(file model.File) {
+	if file.Format != "video/mp4" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	// The CDN could still have the video from before an edit cached
+	p, err := g.download(ctx, file.FileKey)
+	if err != nil {
+		zap.L().Error("Failed to download video for assets", zap.Uint("fileID", file.ID), zap.Error(err))
+		return
+	}
+	defer os.Remove(p)
+
+	if err := g.makeSprites(ctx, file, p); err != nil {
+		zap.L().Error("Failed to generate sprites", zap.Uint("fileID", file.ID), zap.Error(err))
+	}
+
+	if err := g.makePreview(ctx, file, p); err != nil {
+		zap.L().Error("Failed to generate preview", zap.Uint("fileID", file.ID), zap.Error(err))
+	}
+
+	redis.InvalidateCache("user:" + file.UserID)
+	redis.InvalidateCache("file:" + fmt.Sprint(file.ID))
+}
+
+func (g *AssetGenerator) makeSprites(ctx context.Context, file model.File, p string) error {
+	base := "sprites/" + strings.TrimSuffix(file.FileKey, path.Ext(file.FileKey)) + "-" + util.RandStr(6)
+	sheetKey, vttKey := base+".webp", base+".vtt"
+
+	vttPath, sheetPath, err := MakeSprites(ctx, p, path.Base(sheetKey), file.UserID, g.JobQueue)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(vttPath)
+	defer os.Remove(sheetPath)
+
+	if err := g.upload(ctx, sheetPath, sheetKey, "image/webp"); err != nil {
+		return err
+	}
+
+	if err := g.upload(ctx, vttPath, vttKey, "text/vtt"); err != nil {
+		g.delete(sheetKey)
+		return err
+	}
+
+	err = g.DB.
+		Model(model.File{}).
+		Where("id = ?", file.ID).
+		Update("sprites_key", vttKey).
+		Error
+	if err != nil {
+		g.delete(sheetKey, vttKey)
+		return err
+	}
+
+	// Sprites of the previous version of the video
+	if file.SpritesKey != "" {
+		g.delete(file.SpritesKey, SpriteSheetKey(file.SpritesKey))
+	}
+
+	return nil
+}
+
+func (g *AssetGenerator) makePreview(ctx context.Context, file model.File, p string) error {
+	key := "previews/" + strings.TrimSuffix(file.FileKey, path.Ext(file.FileKey)) + "-" + util.RandStr(6) + ".mp4"
+
+	previewPath, err := MakePreview(ctx, p, file.UserID, g.JobQueue)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(previewPath)
+
+	if err := g.upload(ctx, previewPath, key, "video/mp4"); err != nil {
+		return err
+	}
+
+	err = g.DB.
+		Model(model.File{}).
+		Where("id = ?", file.ID).
+		Update("preview_key", key).
+		Error
+	if err != nil {
+		g.delete(key)
+		return err
+	}
+
+	// Preview of the previous version of the video
+	if file.PreviewKey != "" {
+		g.delete(file.PreviewKey)
+	}
+
+	return nil
+}
+
+// SpriteSheetKey returns the key of the sheet that belongs to a sprite
+// WebVTT file
+func SpriteSheetKey(vttKey string) string {
+	return strings.TrimSuffix(vttKey, ".vtt") + ".webp"
+}
+
+// download fetches an object straight from S3 into a temporary file
+func (g *AssetGenerator) download(ctx context.Context, key string) (string, error) {
+	obj, err := g.S3.C.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: g.S3.Bucket,
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download object from S3, %w", err)
+	}
+	defer obj.Body.Close()
+
+	temp, err := os.CreateTemp("", "assets-*"+path.Ext(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file, %w", err)
+	}
+	defer temp.Close()
+
+	if _, err := io.Copy(temp, obj.Body); err != nil {
+		os.Remove(temp.Name())
+		return "", fmt.Errorf("failed to copy object to temp, %w", err)
+	}
+
+	return temp.Name(), nil
+}
+
+func (g *AssetGenerator) upload(ctx context.Context, p, key, contentType string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = g.S3.C.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       g.S3.Bucket,
+		Key:          aws.String(key),
+		Body:         f,
+		CacheControl: aws.String("public, max-age=86400, stale-while-revalidate=3600"),
+		ContentType:  aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to S3, %w", key, err)
+	}
+
+	return nil
+}
+
+// delete removes objects on a best effort basis
+func (g *AssetGenerator) delete(keys ...string) {
+	for _, key := range keys {
+		_, err := g.S3.C.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: g.S3.Bucket,
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			zap.L().Error("Failed to delete object from S3", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"strings"
+)
+
+// makeAudioFlags finishes the flags of an audio export. The input flags
+// are already set up and the video is never decoded
+func makeAudioFlags(opts *validators.ProcessingOptions, streams []ProbeStream, args []string, duration float64) ([]string, float64, error) {
+	g := newFilterGraph()
+
+	if err := addAudioFilters(g, opts, streams); err != nil {
+		return nil, 0, err
+	}
+
+	if err := addMusicFilters(g, opts, duration); err != nil {
+		return nil, 0, err
+	}
+
+	if g.noAudio {
+		return nil, 0, errors.New("video has no audio to export")
+	}
+
+	if err := addFadeFilters(g, opts, duration); err != nil {
+		return nil, 0, err
+	}
+
+	// Background music is read from another input
+	for _, in := range g.inputs {
+		args = append(args, in...)
+	}
+
+	if audio := g.flushAudio(); isInputPad(audio) {
+		args = append(args, "-map", audio)
+	} else {
+		args = append(args, "-filter_complex", strings.Join(g.chains, ";"), "-map", "["+audio+"]")
+	}
+
+	switch opts.ExportFormat {
+	case "mp3":
+		args = append(args, "-c:a", "libmp3lame", "-q:a", "2", "-f", "mp3")
+	case "opus":
+		args = append(args, "-c:a", "libopus", "-b:a", "128k", "-f", "ogg")
+	case "wav":
+		args = append(args, "-c:a", "pcm_s16le", "-f", "wav")
+	}
+
+	return append(args, pipeFlags()...), duration, nil
+}
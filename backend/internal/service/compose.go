@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ComposeOptions describe how two videos are put into one frame
+type ComposeOptions struct {
+	Layout      string  // pip, side-by-side or stacked
+	PiPPosition string  // One of the watermark positions
+	PiPScale    float64 // Width of the inset relative to the main video
+	PiPMargin   int     // In pixels
+	Audio       string  // main, overlay or mix
+}
+
+// MakeComposeFlags puts the overlay video on top of or next to the main one.
+// The output is as long as the main video, a shorter overlay holds its last
+// frame. Every layout is an overlay on a canvas so the videos don't need
+// matching frame rates
+func MakeComposeFlags(main, overlay ConcatInput, opts ComposeOptions) ([]string, float64, error) {
+	encoder := os.Getenv("FFMPEG_ENCODER")
+	if encoder == "" {
+		encoder = "libx264"
+	}
+
+	var args []string
+	var streams [2][]ProbeStream
+	var videos [2]*ProbeStream
+	var duration float64
+
+	for i, in := range []ConcatInput{main, overlay} {
+		s, err := ProbeStreams(in.Path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+		}
+
+		video := FirstStream(s, "video")
+		if video == nil {
+			return nil, 0, fmt.Errorf("input %d has no video stream", i)
+		}
+
+		streams[i], videos[i] = s, video
+
+		d := in.TrimEnd - in.TrimStart
+		if in.TrimEnd <= 0 {
+			full, err := GetDuration(in.Path)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+			}
+
+			d = full - in.TrimStart
+		}
+
+		if d <= 0 {
+			return nil, 0, fmt.Errorf("input %d: %w", i, ErrEmptyInput)
+		}
+
+		if i == 0 {
+			duration = d
+		}
+
+		if in.TrimStart > 0 {
+			args = append(args, "-ss", util.FloatToTimestamp(in.TrimStart))
+		}
+
+		args = append(args, "-t", util.FloatToTimestamp(d), "-i", in.Path)
+	}
+
+	w, h := videos[0].DisplaySize()
+	w, h = w&^1, h&^1
+
+	ow, oh := videos[1].DisplaySize()
+	if ow <= 0 || oh <= 0 {
+		return nil, 0, errors.New("overlay video has no size")
+	}
+
+	base := []string{fmt.Sprintf("scale=%d:%d", w, h), "setsar=1"}
+	var inset []string
+	var x, y string
+
+	switch opts.Layout {
+	case "pip":
+		width := max(2, int(float64(w)*opts.PiPScale)&^1)
+		inset = []string{fmt.Sprintf("scale=%d:-2", width), "setsar=1"}
+		x, y = overlayPosition(opts.PiPPosition, opts.PiPMargin, "W", "H", "w", "h")
+	case "side-by-side":
+		// The overlay gets the height of the main video
+		width := max(2, (ow*h/oh)&^1)
+		base = append(base, fmt.Sprintf("pad=%d:%d:0:0:black", w+width, h))
+		inset = []string{fmt.Sprintf("scale=%d:%d", width, h), "setsar=1"}
+		x, y = fmt.Sprintf("%d", w), "0"
+	case "stacked":
+		// The overlay gets the width of the main video
+		height := max(2, (oh*w/ow)&^1)
+		base = append(base, fmt.Sprintf("pad=%d:%d:0:0:black", w, h+height))
+		inset = []string{fmt.Sprintf("scale=%d:%d", w, height), "setsar=1"}
+		x, y = "0", fmt.Sprintf("%d", h)
+	default:
+		return nil, 0, fmt.Errorf("unknown layout %q", opts.Layout)
+	}
+
+	chains := []string{
+		chain([]string{"0:v:0"}, base, "base"),
+		chain([]string{"1:v:0"}, inset, "inset"),
+		chain([]string{"base", "inset"}, []string{
+			fmt.Sprintf("overlay=x=%s:y=%s:eof_action=repeat", x, y),
+			"format=yuv420p",
+		}, "vout"),
+	}
+
+	var audioIn []string
+	if (opts.Audio == "main" || opts.Audio == "mix") && CountStreams(streams[0], "audio") > 0 {
+		audioIn = append(audioIn, "0:a:0")
+	}
+
+	if (opts.Audio == "overlay" || opts.Audio == "mix") && CountStreams(streams[1], "audio") > 0 {
+		audioIn = append(audioIn, "1:a:0")
+	}
+
+	maps := []string{"-map", "[vout]"}
+
+	if len(audioIn) > 0 {
+		// The audio can't outlast the main video
+		filters := []string{fmt.Sprintf("atrim=duration=%.3f", duration)}
+		if len(audioIn) > 1 {
+			filters = append([]string{"amix=inputs=2:duration=first:dropout_transition=0"}, filters...)
+		}
+
+		chains = append(chains, chain(audioIn, filters, "aout"))
+		maps = append(maps, "-map", "[aout]", "-c:a", "aac", "-b:a", "128k")
+	} else {
+		maps = append(maps, "-an")
+	}
+
+	args = append(args, "-filter_complex", strings.Join(chains, ";"))
+	args = append(args, maps...)
+	args = append(args, "-c:v", encoder)
+
+	return append(args, pipeOutputFlags()...), duration, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ConcatInput is a single clip of a concatenation
+type ConcatInput struct {
+	Path      string
+	TrimStart float64
+	TrimEnd   float64 // 0 means until the end of the clip
+}
+
+// ErrEmptyInput is returned when a clip is trimmed past its end
+var ErrEmptyInput = errors.New("input is empty after trimming")
+
+// Frame rate used when the first clip doesn't report one
+const defaultFrameRate = 30.0
+
+// MakeConcatFlags joins the inputs into a single video. Every clip is scaled
+// and padded to the resolution of the first one and converted to the same
+// frame rate and audio format so the concat filter accepts them. Clips
+// without audio get silence. A crossfade above 0 blends the clips into each
+// other instead of cutting between them
+func MakeConcatFlags(inputs []ConcatInput, crossfade float64) ([]string, float64, error) {
+	if len(inputs) < 2 {
+		return nil, 0, errors.New("at least 2 inputs are needed")
+	}
+
+	encoder := os.Getenv("FFMPEG_ENCODER")
+	if encoder == "" {
+		encoder = "libx264"
+	}
+
+	var args, chains, concatIn, vParts, aParts []string
+	var lengths []float64
+	var w, h int
+	var fps, total float64
+
+	for i, in := range inputs {
+		streams, err := ProbeStreams(in.Path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+		}
+
+		video := FirstStream(streams, "video")
+		if video == nil {
+			return nil, 0, fmt.Errorf("input %d has no video stream", i)
+		}
+
+		if i == 0 {
+			w, h = video.DisplaySize()
+			// Most encoders need even dimensions
+			w, h = w&^1, h&^1
+
+			fps = video.FrameRate()
+			if fps <= 0 || fps > 60 {
+				fps = defaultFrameRate
+			}
+		}
+
+		duration := in.TrimEnd - in.TrimStart
+		if in.TrimEnd <= 0 {
+			full, err := GetDuration(in.Path)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+			}
+
+			duration = full - in.TrimStart
+		}
+
+		if duration <= 0 {
+			return nil, 0, fmt.Errorf("input %d: %w", i, ErrEmptyInput)
+		}
+
+		total += duration
+		lengths = append(lengths, duration)
+
+		if in.TrimStart > 0 {
+			args = append(args, "-ss", util.FloatToTimestamp(in.TrimStart))
+		}
+
+		args = append(args, "-t", util.FloatToTimestamp(duration), "-i", in.Path)
+
+		v, a := "v"+strconv.Itoa(i), "a"+strconv.Itoa(i)
+
+		chains = append(chains, chain([]string{fmt.Sprintf("%d:v:0", i)}, []string{
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", w, h),
+			fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", w, h),
+			"setsar=1",
+			fmt.Sprintf("fps=%.3f", fps),
+			"format=yuv420p",
+		}, v))
+
+		if CountStreams(streams, "audio") > 0 {
+			chains = append(chains, chain([]string{fmt.Sprintf("%d:a:0", i)}, []string{
+				"aformat=sample_rates=48000:channel_layouts=stereo",
+			}, a))
+		} else {
+			chains = append(chains, fmt.Sprintf("anullsrc=r=48000:cl=stereo,atrim=duration=%.3f[%s]", duration, a))
+		}
+
+		concatIn = append(concatIn, v, a)
+		vParts, aParts = append(vParts, v), append(aParts, a)
+	}
+
+	vOut, aOut := "vout", "aout"
+
+	if crossfade > 0 {
+		if err := CheckCrossfade(lengths, crossfade); err != nil {
+			return nil, 0, err
+		}
+
+		// The clips are already chained up, only the joining is left
+		g := newFilterGraph()
+		vOut, aOut = g.crossfade(vParts, aParts, lengths, crossfade)
+
+		chains = append(chains, g.chains...)
+		total -= crossfade * float64(len(inputs)-1)
+	} else {
+		chains = append(chains, chain(concatIn, []string{fmt.Sprintf("concat=n=%d:v=1:a=1", len(inputs))}, vOut, aOut))
+	}
+
+	args = append(args,
+		"-filter_complex", strings.Join(chains, ";"),
+		"-map", "["+vOut+"]",
+		"-map", "["+aOut+"]",
+		"-c:v", encoder,
+		"-c:a", "aac",
+		"-b:a", "128k",
+	)
+
+	return append(args, pipeOutputFlags()...), total, nil
+}
@@ -44,3 +44,24 @@ func Crop(path string, opts []int) (string, error) {
 
 	return tmpFile.Name(), nil
 }
+
+// ResizeThumbnail runs vips to turn an uploaded image into a WebP thumbnail
+// no wider than a captured one. Callers must remove the returned file
+func ResizeThumbnail(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	tmpFile, err := os.CreateTemp("", "thumbnail-*.webp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for vips, %w", err)
+	}
+	tmpFile.Close()
+
+	cmd := exec.CommandContext(ctx, "vips", "thumbnail", path, tmpFile.Name()+"[Q=85]", "1280", "--size", "down")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("vips failed, %w (%s)", err, out)
+	}
+
+	return tmpFile.Name(), nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// CropRect is a crop area in the same shape as the crop processing options
+type CropRect struct {
+	CropX int `json:"cropX"`
+	CropY int `json:"cropY"`
+	CropW int `json:"cropW"`
+	CropH int `json:"cropH"`
+}
+
+// Frames sampled by cropdetect. Only keyframes are decoded so this covers
+// most videos from start to end
+const maxCropDetectFrames = 300
+
+// DetectCrop looks for black bars around the picture and returns the area
+// inside of them. Returns nil if the video has no bars. Coordinates refer to
+// the upright video, same as the crop options
+func DetectCrop(ctx context.Context, p, userID string, j *JobQueue) (*CropRect, error) {
+	streams, err := ProbeStreams(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+	}
+
+	video := FirstStream(streams, "video")
+	if video == nil {
+		return nil, errors.New("no video stream found")
+	}
+
+	w, h := video.DisplaySize()
+
+	zap.L().Debug("Running FFmpeg to detect black bars")
+
+	// reset=0 grows the area over every frame so dark scenes don't make it
+	// smaller than the actual picture
+	var stdOut bytes.Buffer
+
+	done := make(chan error, 1)
+	err = j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Output: &stdOut,
+		Args: &[]string{
+			"-loglevel", "error",
+			"-skip_frame", "nokey",
+			"-i", p,
+			"-an",
+			"-vf", "cropdetect=limit=24:round=2:reset=0,metadata=mode=print:file=-",
+			"-frames:v", strconv.Itoa(maxCropDetectFrames),
+			"-f", "null",
+			"-",
+		},
+		Ctx:        ctx,
+		Done:       done,
+		NoProgress: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	rect := CropRect{}
+	found := false
+
+	// The last frame has the final area
+	scanner := bufio.NewScanner(&stdOut)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+
+		switch key {
+		case "lavfi.cropdetect.x":
+			rect.CropX = v
+		case "lavfi.cropdetect.y":
+			rect.CropY = v
+		case "lavfi.cropdetect.w":
+			rect.CropW = v
+			found = true
+		case "lavfi.cropdetect.h":
+			rect.CropH = v
+		}
+	}
+
+	if !found || rect.CropW <= 0 || rect.CropH <= 0 {
+		return nil, nil
+	}
+
+	// Bars of a few pixels come from rounding and aren't worth re-encoding for
+	if rect.CropW >= w-4 && rect.CropH >= h-4 {
+		return nil, nil
+	}
+
+	if rect.CropX+rect.CropW > w || rect.CropY+rect.CropH > h {
+		return nil, fmt.Errorf("detected crop %dx%d+%d+%d is outside of the %dx%d frame", rect.CropW, rect.CropH, rect.CropX, rect.CropY, w, h)
+	}
+
+	return &rect, nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+)
+
+// DownloadFile fetches a stored object from the CDN into a temporary file
+// and returns its path. Callers must remove the file after using it
+func DownloadFile(ctx context.Context, key string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, util.FileURL(key), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare download request, %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download file from cloudfront, %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cloudfront returned non-OK status %d", resp.StatusCode)
+	}
+
+	temp, err := os.CreateTemp("", "download-*"+path.Ext(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file, %w", err)
+	}
+	defer temp.Close()
+
+	if _, err := io.Copy(temp, resp.Body); err != nil {
+		os.Remove(temp.Name())
+		return "", fmt.Errorf("failed to copy file to temp, %w", err)
+	}
+
+	return temp.Name(), nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"fmt"
+)
+
+// fadeFilters returns the fade in and fade out filters for a stream of the
+// provided duration. The filter is either fade or afade
+func fadeFilters(filter string, fadeIn, fadeOut, duration float64) []string {
+	filters := []string{}
+
+	if fadeIn > 0 {
+		filters = append(filters, fmt.Sprintf("%s=t=in:st=0:d=%.3f", filter, fadeIn))
+	}
+
+	if fadeOut > 0 {
+		filters = append(filters, fmt.Sprintf("%s=t=out:st=%.3f:d=%.3f", filter, max(duration-fadeOut, 0), fadeOut))
+	}
+
+	return filters
+}
+
+// addFadeFilters fades the output of the provided duration in and out. Has
+// to run last so the fades end up on the final timeline
+func addFadeFilters(g *filterGraph, opts *validators.ProcessingOptions, duration float64) error {
+	if opts.FadeIn <= 0 && opts.FadeOut <= 0 {
+		return nil
+	}
+
+	if opts.FadeIn+opts.FadeOut > duration {
+		return fmt.Errorf("%w, fades are longer than the output (%.2fs > %.2fs)", ErrInvalidOptions, opts.FadeIn+opts.FadeOut, duration)
+	}
+
+	if !opts.IsAudioOnly() {
+		g.video = append(g.video, fadeFilters("fade", opts.FadeIn, opts.FadeOut, duration)...)
+	}
+
+	if !g.noAudio {
+		g.audio = append(g.audio, fadeFilters("afade", opts.FadeIn, opts.FadeOut, duration)...)
+	}
+
+	return nil
+}
+
+// CheckCrossfade makes sure every joined part is long enough to blend into
+// its neighbours
+func CheckCrossfade(lengths []float64, crossfade float64) error {
+	for i, l := range lengths {
+		// Parts in the middle fade on both ends
+		need := crossfade
+		if i > 0 && i < len(lengths)-1 {
+			need *= 2
+		}
+
+		if l <= need {
+			return fmt.Errorf("%w, part %d is too short for a %.2fs crossfade (%.2fs)", ErrInvalidOptions, i, crossfade, l)
+		}
+	}
+
+	return nil
+}
+
+// crossfade joins the video and audio parts by blending each one into the
+// next instead of cutting. Every blend shortens the output by the crossfade
+// duration. Returns the pads holding the joined streams
+func (g *filterGraph) crossfade(video, audio []string, lengths []float64, d float64) (string, string) {
+	vOut, aOut := video[0], ""
+	if len(audio) > 0 {
+		aOut = audio[0]
+	}
+
+	offset := 0.0
+	for i := 1; i < len(video); i++ {
+		// The blend starts before the end of everything joined so far
+		offset += lengths[i-1] - d
+
+		v := g.label("vx")
+		g.chains = append(g.chains, chain([]string{vOut, video[i]}, []string{
+			fmt.Sprintf("xfade=transition=fade:duration=%.3f:offset=%.3f", d, offset),
+		}, v))
+		vOut = v
+
+		if len(audio) == 0 {
+			continue
+		}
+
+		a := g.label("ax")
+		g.chains = append(g.chains, chain([]string{aOut, audio[i]}, []string{
+			fmt.Sprintf("acrossfade=d=%.3f", d),
+		}, a))
+		aOut = a
+	}
+
+	return vOut, aOut
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckCrossfade(t *testing.T) {
+	tests := []struct {
+		name      string
+		lengths   []float64
+		crossfade float64
+		wantErr   bool
+	}{
+		{"long enough", []float64{2, 3, 2}, 1, false},
+		{"two parts", []float64{1.5, 1.5}, 1, false},
+		{"first too short", []float64{1, 3}, 1, true},
+		{"last too short", []float64{3, 0.5}, 1, true},
+		// Parts in the middle fade on both ends
+		{"middle too short", []float64{3, 2, 3}, 1, true},
+		{"middle long enough", []float64{3, 2.1, 3}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCrossfade(tt.lengths, tt.crossfade)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("error %v doesn't wrap ErrInvalidOptions", err)
+			}
+		})
+	}
+}
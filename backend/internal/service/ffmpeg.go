@@ -11,6 +11,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -26,8 +27,24 @@ type FFmpegJob struct {
 	UseGPU   bool
 	Opts     *validators.ProcessingOptions
 	Args     *[]string
+	Duration float64 // Output duration used for progress when Args are provided
 	Ctx      context.Context
 	Done     chan error
+
+	// Background jobs, like rendering the assets of a file, only run when
+	// no other job is waiting. They don't report progress so they can't
+	// overwrite the progress of a job the user is waiting for, and they
+	// don't take up space in the queue
+	Background bool
+	// NoProgress jobs run with the same priority as the others but leave
+	// the progress of the user alone. Meant for analysis passes that run
+	// before the job the user is actually waiting for
+	NoProgress bool
+}
+
+// tracksProgress reports if the job writes to the progress of its user
+func (j *FFmpegJob) tracksProgress() bool {
+	return !j.Background && !j.NoProgress
 }
 
 type FFMpegJobStats struct {
@@ -38,14 +55,20 @@ type FFMpegJobStats struct {
 }
 
 type JobQueue struct {
-	jobs    chan *FFmpegJob
-	running atomic.Int32
-	workers int64
+	jobs       chan *FFmpegJob
+	background chan *FFmpegJob
+	running    atomic.Int32
+	workers    int64
 }
 
 var (
 	ErrJobQueueFull = errors.New("job queue is full")
 	ErrJobExists    = errors.New("a job is already running for this user")
+	// Reversing keeps every decoded frame in memory
+	ErrTooLongToBuffer = errors.New("clip is too long to reverse")
+	// Wrapped by the errors of MakeFFmpegFlags the user can fix, like a
+	// crop area that's bigger than the video
+	ErrInvalidOptions = errors.New("options don't fit the video")
 )
 
 // NewJobQueue initializes a new job queue that limits the
@@ -60,8 +83,9 @@ func NewJobQueue() *JobQueue {
 	zap.L().Debug("Initializing job queue", zap.Int64("max_jobs", maxJobs))
 
 	return &JobQueue{
-		jobs:    make(chan *FFmpegJob, maxJobs),
-		workers: workers,
+		jobs:       make(chan *FFmpegJob, maxJobs),
+		background: make(chan *FFmpegJob, maxJobs),
+		workers:    workers,
 	}
 }
 
@@ -72,37 +96,71 @@ func (q *JobQueue) StartWorkerPool() {
 }
 
 func (q *JobQueue) worker() {
-	for job := range q.jobs {
-		err := q.runFFmpegJob(job)
+	for {
+		// Jobs users are waiting for always go first
+		select {
+		case job := <-q.jobs:
+			q.run(job)
+			continue
+		default:
+		}
 
-		job.Done <- err
-		close(job.Done)
+		select {
+		case job := <-q.jobs:
+			q.run(job)
+		case job := <-q.background:
+			q.run(job)
+		}
+	}
+}
+
+func (q *JobQueue) run(job *FFmpegJob) {
+	err := q.runFFmpegJob(job)
+
+	job.Done <- err
+	close(job.Done)
 
+	if !job.Background {
 		q.running.Add(-1)
+	}
+
+	if job.tracksProgress() {
 		ProgressMap.Delete(job.UserID)
+	}
 
-		if err != nil {
-			zap.L().Error("FFmpeg job finished with an error",
-				zap.String("user_id", job.UserID),
-				zap.String("job_id", job.ID),
-				zap.Error(err))
-		} else {
-			zap.L().Debug("FFmpeg job finished successfully")
-		}
+	if err != nil {
+		zap.L().Error("FFmpeg job finished with an error",
+			zap.String("user_id", job.UserID),
+			zap.String("job_id", job.ID),
+			zap.Error(err))
+	} else {
+		zap.L().Debug("FFmpeg job finished successfully")
 	}
 }
 
 func (q *JobQueue) Enqueue(job *FFmpegJob) error {
+	if job.Background {
+		select {
+		case q.background <- job:
+			zap.L().Debug("New background ffmpeg job enqueued", zap.String("user_id", job.UserID))
+			return nil
+		default:
+			return ErrJobQueueFull
+		}
+	}
+
 	if q.running.Load() >= int32(cap(q.jobs)) {
-		return errors.New("job queue full")
+		return ErrJobQueueFull
 	}
 
-	ProgressMap.Store(job.UserID, FFMpegJobStats{
-		Progress: 0.0,
-		JobID:    job.ID,
-		State:    "Processing video...",
-		Stopped:  false,
-	})
+	if job.tracksProgress() {
+		ProgressMap.Store(job.UserID, FFMpegJobStats{
+			Progress: 0.0,
+			JobID:    job.ID,
+			State:    "Processing video...",
+			Stopped:  false,
+		})
+	}
 
 	q.jobs <- job
 	q.running.Add(1)
@@ -110,40 +168,135 @@ func (q *JobQueue) Enqueue(job *FFmpegJob) error {
 	return nil
 }
 
-func (q *JobQueue) MakeFFmpegFlags(opts *validators.ProcessingOptions, p string) ([]string, float64, error) {
-	args := []string{}
+// Reversing keeps every decoded frame in memory so the amount of pixels a
+// reversed clip may have is limited. It's about 20 seconds of 1080p30
+const maxBufferedPixels = 1920 * 1080 * 30 * 20
 
-	encoder := os.Getenv("FFMPEG_ENCODER")
-	if encoder == "" {
-		encoder = "libx264"
+// CheckBufferedDuration makes sure a reversed clip is short enough after
+// trimming and cutting segments. It's meant to be called before the job is
+// enqueued so a clip that's too long is reported to the user right away
+func CheckBufferedDuration(opts *validators.ProcessingOptions, p string) error {
+	if opts.FastTrim || !opts.Reverse {
+		return nil
 	}
 
-	var duration float64
-	var err error
-
-	args = append(args, "-i", p)
+	streams, err := ProbeStreams(p)
+	if err != nil {
+		return fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+	}
 
-	if opts.TrimStart > 0 {
-		args = append(args, "-ss", util.FloatToTimestamp(opts.TrimStart))
+	// Reported by MakeFFmpegFlags
+	video := FirstStream(streams, "video")
+	if video == nil {
+		return nil
 	}
 
+	var duration float64
+
 	if opts.TrimEnd > 0 && opts.TrimStart >= 0 {
-		args = append(args, "-to", util.FloatToTimestamp(opts.TrimEnd))
 		duration = opts.TrimEnd - opts.TrimStart
 	} else {
 		duration, err = GetDuration(p)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+			return fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
 		}
 	}
 
-	args = append(args, "-c:v", encoder)
+	if len(opts.Segments) > 0 {
+		ranges := segmentsToKeep(opts, duration)
+		duration = ranges.Duration()
 
+		if opts.Crossfade > 0 && len(ranges) > 1 {
+			duration -= opts.Crossfade * float64(len(ranges)-1)
+		}
+	}
+
+	return checkBufferedDuration(opts, video, duration)
+}
+
+func checkBufferedDuration(opts *validators.ProcessingOptions, video *ProbeStream, duration float64) error {
+	if !opts.Reverse {
+		return nil
+	}
+
+	// Frames are reversed after cropping so only the cropped area is kept
+	w, h := video.DisplaySize()
 	if opts.ShouldCrop {
-		cropStr := fmt.Sprintf("crop=%d:%d:%d:%d", opts.CropW, opts.CropH, opts.CropX, opts.CropY)
-		args = append(args, "-vf", cropStr)
+		w, h = opts.CropW, opts.CropH
 	}
 
+	fps := video.FrameRate()
+	if fps <= 0 {
+		fps = 30
+	}
+
+	limit := maxBufferedPixels / (float64(max(w*h, 1)) * fps)
+	if duration > limit {
+		return fmt.Errorf("%w (%.2fs > %.2fs at %dx%d and %.0f fps)", ErrTooLongToBuffer, duration, limit, w, h, fps)
+	}
+
+	return nil
+}
+
+func (q *JobQueue) MakeFFmpegFlags(opts *validators.ProcessingOptions, p string) ([]string, float64, error) {
+	if opts.FastTrim {
+		return makeFastTrimFlags(opts, p)
+	}
+
+	encoder := os.Getenv("FFMPEG_ENCODER")
+	if encoder == "" {
+		encoder = "libx264"
+	}
+
+	if opts.IsAudioOnly() {
+		streams, err := ProbeStreams(p)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+		}
+
+		args, duration, err := trimmedInputFlags(opts, p)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return makeAudioFlags(opts, streams, args, duration)
+	}
+
+	var args []string
+	var g *filterGraph
+	var duration float64
+	var err error
+
+	// The clip was already rendered by RenderLoop and only has to be read
+	// multiple times
+	if opts.Loop > 1 {
+		args, g, duration, err = loopInputFlags(opts)
+	} else {
+		args, g, duration, err = makeClipFlags(opts, p)
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := addMusicFilters(g, opts, duration); err != nil {
+		return nil, 0, err
+	}
+
+	if err := addFadeFilters(g, opts, duration); err != nil {
+		return nil, 0, err
+	}
+
+	if opts.IsAnimated() {
+		addAnimationFilters(g, opts)
+
+		args = append(args, g.args()...)
+		return append(args, animationOutputFlags(opts)...), duration, nil
+	}
+
+	args = append(args, g.args()...)
+	args = append(args, "-c:v", encoder)
+
 	if opts.LosslessExport {
 		switch encoder {
 		case "libx264":
@@ -169,20 +322,251 @@ func (q *JobQueue) MakeFFmpegFlags(opts *validators.ProcessingOptions, p string)
 		)
 	}
 
-	args = append(args,
-		"-c:a", "copy",
-		"-movflags", "+frag_keyframe+empty_moov+faststart",
-		"-loglevel", "error",
-	)
+	args = append(args, pipeOutputFlags()...)
+
+	return args, duration, nil
+}
+
+// trimmedInputFlags opens the video and trims it on the input so filters
+// that change timestamps don't affect where the cut points are. Returns the
+// duration of the trimmed input
+func trimmedInputFlags(opts *validators.ProcessingOptions, p string) ([]string, float64, error) {
+	args := []string{}
+
+	if opts.TrimStart > 0 {
+		args = append(args, "-ss", util.FloatToTimestamp(opts.TrimStart))
+	}
+
+	var duration float64
 
-	args = append(args,
+	if opts.TrimEnd > 0 && opts.TrimStart >= 0 {
+		duration = opts.TrimEnd - opts.TrimStart
+		args = append(args, "-t", util.FloatToTimestamp(duration))
+	} else {
+		var err error
+
+		duration, err = GetDuration(p)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+		}
+	}
+
+	return append(args, "-i", p), duration, nil
+}
+
+// makeClipFlags sets up the input and every filter that's applied to a
+// single play of the clip. Music, fades and the export format are left to
+// the caller as they apply to the whole output, loops included
+func makeClipFlags(opts *validators.ProcessingOptions, p string) ([]string, *filterGraph, float64, error) {
+	streams, err := ProbeStreams(p)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+	}
+
+	args, duration, err := trimmedInputFlags(opts, p)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	video := FirstStream(streams, "video")
+	if video == nil {
+		return nil, nil, 0, errors.New("no video stream found")
+	}
+
+	g := newFilterGraph()
+
+	if err := addRedactionFilters(g, opts, video); err != nil {
+		return nil, nil, 0, err
+	}
+
+	// FFmpeg autorotates the input before it reaches any filters so crop
+	// coordinates match what the user saw in the player
+	if opts.ShouldCrop {
+		w, h := video.DisplaySize()
+		if opts.CropX+opts.CropW > w || opts.CropY+opts.CropH > h {
+			return nil, nil, 0, fmt.Errorf("%w, crop area %dx%d+%d+%d is outside of the %dx%d frame", ErrInvalidOptions, opts.CropW, opts.CropH, opts.CropX, opts.CropY, w, h)
+		}
+
+		g.video = append(g.video, fmt.Sprintf("crop=%d:%d:%d:%d", opts.CropW, opts.CropH, opts.CropX, opts.CropY))
+	}
+
+	stabilize, err := stabilizeFilters(opts)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	g.video = append(g.video, stabilize...)
+	g.video = append(g.video, adjustFilters(&opts.Adjustments)...)
+	g.video = append(g.video, orientationFilters(opts)...)
+
+	w, h := orientedSize(opts, video)
+	addReframeFilters(g, opts, w, h)
+
+	if opts.SubtitlePath != "" {
+		// Subtitles are timed against the source so the trimmed input
+		// is shifted back for the duration of the filter
+		g.video = append(g.video,
+			fmt.Sprintf("setpts=PTS+%.3f/TB", max(opts.TrimStart, 0)),
+			"subtitles=filename="+escapeFilterValue(opts.SubtitlePath),
+			"setpts=PTS-STARTPTS",
+		)
+	}
+
+	if err := addAudioFilters(g, opts, streams); err != nil {
+		return nil, nil, 0, err
+	}
+
+	addOverlayFilters(g, opts, video)
+
+	if len(opts.Segments) > 0 {
+		ranges := segmentsToKeep(opts, duration)
+		if len(ranges) == 0 {
+			return nil, nil, 0, fmt.Errorf("%w, segments don't leave anything to render", ErrInvalidOptions)
+		}
+
+		duration = ranges.Duration()
+
+		if opts.Crossfade > 0 && len(ranges) > 1 {
+			lengths := []float64{}
+			for _, r := range ranges {
+				lengths = append(lengths, r.End-r.Start)
+			}
+
+			if err := CheckCrossfade(lengths, opts.Crossfade); err != nil {
+				return nil, nil, 0, err
+			}
+
+			duration -= opts.Crossfade * float64(len(ranges)-1)
+		}
+
+		g.cut(ranges, opts.Crossfade)
+	}
+
+	if err := checkBufferedDuration(opts, video, duration); err != nil {
+		return nil, nil, 0, err
+	}
+
+	duration = addTimeFilters(g, opts, duration)
+
+	return args, g, duration, nil
+}
+
+// pipeOutputFlags makes ffmpeg write a streamable mp4 to stdout and
+// its progress to stderr
+func pipeOutputFlags() []string {
+	return append([]string{
+		"-movflags", "+frag_keyframe+empty_moov+faststart",
 		"-f", "mp4",
+	}, pipeFlags()...)
+}
+
+// pipeFlags makes ffmpeg write the output to stdout and its progress to
+// stderr. The format has to be set before
+func pipeFlags() []string {
+	return []string{
+		"-loglevel", "error",
 		"pipe:1",
 		"-progress", "pipe:2",
 		"-nostats",
-	)
+	}
+}
 
-	return args, duration, nil
+// orientationFilters returns the filters needed to rotate and flip a video
+func orientationFilters(opts *validators.ProcessingOptions) []string {
+	filters := []string{}
+
+	switch opts.Rotate {
+	case 90:
+		filters = append(filters, "transpose=clock")
+	case 180:
+		filters = append(filters, "hflip", "vflip")
+	case 270:
+		filters = append(filters, "transpose=cclock")
+	}
+
+	if opts.FlipH {
+		filters = append(filters, "hflip")
+	}
+
+	if opts.FlipV {
+		filters = append(filters, "vflip")
+	}
+
+	return filters
+}
+
+// addAudioFilters decides which audio streams end up in the output and which
+// filters are applied to them
+func addAudioFilters(g *filterGraph, opts *validators.ProcessingOptions, streams []ProbeStream) error {
+	tracks := CountStreams(streams, "audio")
+
+	if opts.Mute || opts.IsAnimated() || tracks == 0 || opts.MusicMode == "replace" {
+		g.noAudio = true
+		return nil
+	}
+
+	if opts.AudioTrack != nil {
+		if *opts.AudioTrack >= tracks {
+			return fmt.Errorf("%w, audio track %d doesn't exist, the file has %d", ErrInvalidOptions, *opts.AudioTrack, tracks)
+		}
+
+		g.audioIn = []string{"0:a:" + strconv.Itoa(*opts.AudioTrack)}
+	}
+
+	// OBS and similar put every source on a separate track
+	if opts.MixAudioTracks && tracks > 1 {
+		g.audioIn = []string{}
+		for i := range tracks {
+			g.audioIn = append(g.audioIn, "0:a:"+strconv.Itoa(i))
+		}
+
+		g.audio = append(g.audio, fmt.Sprintf("amix=inputs=%d:duration=longest", tracks))
+	}
+
+	if opts.NormalizeAudio {
+		// loudnorm upsamples to 192kHz so it has to be brought back down
+		g.audio = append(g.audio, "loudnorm=I=-16:TP=-1.5:LRA=11", "aresample=48000")
+	}
+
+	if opts.AudioGain != 0 {
+		g.audio = append(g.audio, fmt.Sprintf("volume=%.1fdB", opts.AudioGain))
+	}
+
+	return nil
+}
+
+// segmentsToKeep turns the segments of a job into the ranges that should be
+// kept, relative to the already trimmed input of the provided duration
+func segmentsToKeep(opts *validators.ProcessingOptions, duration float64) validators.TimeRanges {
+	start := max(opts.TrimStart, 0)
+	end := start + duration
+
+	var ranges validators.TimeRanges
+	if opts.SegmentMode == "remove" {
+		ranges = opts.Segments.Invert(start, end)
+	} else {
+		ranges = opts.Segments.Clamp(start, end)
+	}
+
+	return ranges.Shift(-start)
+}
+
+// addTimeFilters applies the reverse and speed options and returns the
+// duration of the output. Loops are read from the rendered clip instead
+// so they don't have to be buffered
+func addTimeFilters(g *filterGraph, opts *validators.ProcessingOptions, duration float64) float64 {
+	if opts.Reverse {
+		g.video = append(g.video, "reverse")
+		g.audio = append(g.audio, "areverse")
+	}
+
+	if opts.Speed > 0 && opts.Speed != 1 {
+		g.video = append(g.video, fmt.Sprintf("setpts=(PTS-STARTPTS)/%.4f", opts.Speed))
+		g.audio = append(g.audio, atempoChain(opts.Speed)...)
+		duration /= opts.Speed
+	}
+
+	return duration
 }
 
 // The encoder is always appended
@@ -191,11 +575,10 @@ func addHWAccelFlags(args []string) []string {
 	hwaccel := os.Getenv("FFMPEG_HWACCEL")
 
 	if useGPU && hwaccel != "" {
-		for i, arg := range args {
-			if arg == "-i" && i > 0 {
-				args = append(args[:i], append([]string{"-hwaccel", hwaccel}, args[i:]...)...)
-				break
-			}
+		// Only the first input is decoded on the GPU, the others are
+		// overlays like the watermark or music
+		if i := slices.Index(args, "-i"); i >= 0 {
+			args = slices.Insert(args, i, "-hwaccel", hwaccel)
 		}
 	}
 
@@ -203,7 +586,7 @@ func addHWAccelFlags(args []string) []string {
 }
 
 func (q *JobQueue) runFFmpegJob(job *FFmpegJob) error {
-	var duration float64
+	duration := job.Duration
 	var err error
 
 	if job.Args == nil {
@@ -235,6 +618,12 @@ func (q *JobQueue) runFFmpegJob(job *FFmpegJob) error {
 	stderrBuf := &bytes.Buffer{}
 
 	go func() {
+		// Only kept in case of errors
+		if !job.tracksProgress() {
+			io.Copy(stderrBuf, stderrPipe)
+			return
+		}
+
 		scanner := bufio.NewScanner(io.TeeReader(stderrPipe, stderrBuf))
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -246,7 +635,7 @@ func (q *JobQueue) runFFmpegJob(job *FFmpegJob) error {
 			if after, ok := strings.CutPrefix(line, "out_time_ms="); ok {
 				msStr := after
 				outTimeMs, err := strconv.ParseFloat(msStr, 64)
-				if err == nil {
+				if err == nil && duration > 0 {
 					percent := (outTimeMs / (duration * 1000)) / 10
 					ProgressMap.Store(job.UserID, FFMpegJobStats{
 						JobID:    job.ID,
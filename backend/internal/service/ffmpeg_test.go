@@ -0,0 +1,42 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"testing"
+)
+
+func TestCheckBufferedDuration(t *testing.T) {
+	hd := &ProbeStream{Width: 1920, Height: 1080, AvgFrameRate: "30/1"}
+	uhd := &ProbeStream{Width: 3840, Height: 2160, AvgFrameRate: "60/1"}
+
+	tests := []struct {
+		name     string
+		opts     validators.ProcessingOptions
+		video    *ProbeStream
+		duration float64
+		wantErr  bool
+	}{
+		{"not reversed", validators.ProcessingOptions{}, uhd, 600, false},
+		{"looped isn't buffered", validators.ProcessingOptions{Loop: 10}, uhd, 60, false},
+		{"1080p30 at the limit", validators.ProcessingOptions{Reverse: true}, hd, 20, false},
+		{"1080p30 over the limit", validators.ProcessingOptions{Reverse: true}, hd, 21, true},
+		{"4k60 gets an eighth", validators.ProcessingOptions{Reverse: true}, uhd, 2.5, false},
+		{"4k60 over the limit", validators.ProcessingOptions{Reverse: true}, uhd, 3, true},
+		{"cropped to 720p", validators.ProcessingOptions{Reverse: true, ShouldCrop: true, CropW: 1280, CropH: 720}, uhd, 20, false},
+		{"unknown frame rate", validators.ProcessingOptions{Reverse: true}, &ProbeStream{Width: 1920, Height: 1080}, 21, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBufferedDuration(&tt.opts, tt.video, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrTooLongToBuffer) {
+				t.Errorf("error %v doesn't wrap ErrTooLongToBuffer", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"fmt"
+	"strings"
+)
+
+// filterGraph collects the video and audio filters of a job so they can be
+// passed to ffmpeg as a single -filter_complex. Filters are queued up as
+// linear chains and only closed into labeled pads when a multi-input or
+// multi-output filter needs them. Streams without any filters are mapped
+// directly so they don't have to be touched
+type filterGraph struct {
+	chains  []string
+	videoIn []string
+	video   []string
+	audioIn []string
+	audio   []string
+	noAudio bool
+	labels  int
+	inputs  [][]string
+}
+
+func newFilterGraph() *filterGraph {
+	return &filterGraph{
+		videoIn: []string{"0:v:0"},
+		audioIn: []string{"0:a:0"},
+	}
+}
+
+// chain formats a linear filter chain fed by one or more input pads
+func chain(inputs, filters []string, outputs ...string) string {
+	return "[" + strings.Join(inputs, "][") + "]" + strings.Join(filters, ",") + "[" + strings.Join(outputs, "][") + "]"
+}
+
+// isInputPad reports if a pad refers to an input stream (0:v:0) instead
+// of the output of another filter
+func isInputPad(pad string) bool {
+	return strings.Contains(pad, ":")
+}
+
+// escapeFilterValue quotes a value, like a file path or text, so it can be
+// used as a filter option inside of a filtergraph
+func escapeFilterValue(p string) string {
+	p = strings.ReplaceAll(p, `\`, `\\`)
+	p = strings.ReplaceAll(p, `:`, `\:`)
+	p = strings.ReplaceAll(p, `'`, `'\\\''`)
+
+	return "'" + p + "'"
+}
+
+// input adds another input file after the main video and returns its index
+func (g *filterGraph) input(args ...string) int {
+	g.inputs = append(g.inputs, args)
+	return len(g.inputs)
+}
+
+func (g *filterGraph) label(prefix string) string {
+	g.labels++
+	return fmt.Sprintf("%s%d", prefix, g.labels)
+}
+
+// flushVideo closes the queued video filters into a chain and returns
+// the pad holding the result
+func (g *filterGraph) flushVideo() string {
+	if len(g.video) == 0 && len(g.videoIn) == 1 {
+		return g.videoIn[0]
+	}
+
+	filters := g.video
+	if len(filters) == 0 {
+		filters = []string{"null"}
+	}
+
+	out := g.label("v")
+	g.chains = append(g.chains, chain(g.videoIn, filters, out))
+	g.videoIn, g.video = []string{out}, nil
+
+	return out
+}
+
+// flushAudio closes the queued audio filters into a chain and returns
+// the pad holding the result
+func (g *filterGraph) flushAudio() string {
+	if len(g.audio) == 0 && len(g.audioIn) == 1 {
+		return g.audioIn[0]
+	}
+
+	filters := g.audio
+	if len(filters) == 0 {
+		filters = []string{"anull"}
+	}
+
+	out := g.label("a")
+	g.chains = append(g.chains, chain(g.audioIn, filters, out))
+	g.audioIn, g.audio = []string{out}, nil
+
+	return out
+}
+
+// cut keeps only the provided ranges of the streams and joins them back
+// together with the concat filter, which keeps audio and video in sync.
+// A crossfade above 0 blends the ranges into each other instead. Ranges are
+// relative to the start of the input
+func (g *filterGraph) cut(ranges []validators.TimeRange, crossfade float64) {
+	n := len(ranges)
+	if n == 0 {
+		return
+	}
+
+	video := g.flushVideo()
+	vSplit := make([]string, n)
+	for i := range vSplit {
+		vSplit[i] = g.label("vs")
+	}
+
+	g.chains = append(g.chains, chain([]string{video}, []string{fmt.Sprintf("split=%d", n)}, vSplit...))
+
+	var aSplit []string
+	if !g.noAudio {
+		audio := g.flushAudio()
+		aSplit = make([]string, n)
+		for i := range aSplit {
+			aSplit[i] = g.label("as")
+		}
+
+		g.chains = append(g.chains, chain([]string{audio}, []string{fmt.Sprintf("asplit=%d", n)}, aSplit...))
+	}
+
+	var concatIn, vParts, aParts []string
+	var lengths []float64
+	for i, r := range ranges {
+		v := g.label("vt")
+		g.chains = append(g.chains, chain([]string{vSplit[i]}, []string{
+			fmt.Sprintf("trim=start=%.3f:end=%.3f", r.Start, r.End),
+			"setpts=PTS-STARTPTS",
+		}, v))
+		concatIn = append(concatIn, v)
+		vParts = append(vParts, v)
+		lengths = append(lengths, r.End-r.Start)
+
+		if g.noAudio {
+			continue
+		}
+
+		a := g.label("at")
+		g.chains = append(g.chains, chain([]string{aSplit[i]}, []string{
+			fmt.Sprintf("atrim=start=%.3f:end=%.3f", r.Start, r.End),
+			"asetpts=PTS-STARTPTS",
+		}, a))
+		concatIn = append(concatIn, a)
+		aParts = append(aParts, a)
+	}
+
+	if crossfade > 0 && n > 1 {
+		vOut, aOut := g.crossfade(vParts, aParts, lengths, crossfade)
+
+		g.videoIn = []string{vOut}
+		if !g.noAudio {
+			g.audioIn = []string{aOut}
+		}
+
+		return
+	}
+
+	vOut := g.label("vc")
+	if g.noAudio {
+		g.chains = append(g.chains, chain(concatIn, []string{fmt.Sprintf("concat=n=%d:v=1:a=0", n)}, vOut))
+		g.videoIn = []string{vOut}
+		return
+	}
+
+	aOut := g.label("ac")
+	g.chains = append(g.chains, chain(concatIn, []string{fmt.Sprintf("concat=n=%d:v=1:a=1", n)}, vOut, aOut))
+	g.videoIn, g.audioIn = []string{vOut}, []string{aOut}
+}
+
+// args returns the -filter_complex, -map and audio codec flags of the graph.
+// Audio is stream copied unless it went through a filter
+func (g *filterGraph) args() []string {
+	var maps []string
+
+	if video := g.flushVideo(); isInputPad(video) {
+		maps = append(maps, "-map", video)
+	} else {
+		maps = append(maps, "-map", "["+video+"]")
+	}
+
+	if g.noAudio {
+		maps = append(maps, "-an")
+	} else if audio := g.flushAudio(); isInputPad(audio) {
+		maps = append(maps, "-map", audio+"?", "-c:a", "copy")
+	} else {
+		maps = append(maps, "-map", "["+audio+"]", "-c:a", "aac", "-b:a", "128k")
+	}
+
+	args := []string{}
+	for _, in := range g.inputs {
+		args = append(args, in...)
+	}
+
+	if len(g.chains) > 0 {
+		args = append(args, "-filter_complex", strings.Join(g.chains, ";"))
+	}
+
+	return append(args, maps...)
+}
+
+// atempoChain splits a speed factor into multiple atempo filters as older
+// ffmpeg builds only accept values between 0.5 and 2.0
+func atempoChain(speed float64) []string {
+	filters := []string{}
+
+	for speed > 2.0 {
+		filters = append(filters, "atempo=2.0")
+		speed /= 2.0
+	}
+
+	for speed < 0.5 {
+		filters = append(filters, "atempo=0.5")
+		speed /= 0.5
+	}
+
+	return append(filters, fmt.Sprintf("atempo=%.4f", speed))
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"reflect"
+	"testing"
+)
+
+func TestAtempoChain(t *testing.T) {
+	tests := []struct {
+		speed float64
+		want  []string
+	}{
+		{1.5, []string{"atempo=1.5000"}},
+		{0.5, []string{"atempo=0.5000"}},
+		{2, []string{"atempo=2.0000"}},
+		{4, []string{"atempo=2.0", "atempo=2.0000"}},
+		{3, []string{"atempo=2.0", "atempo=1.5000"}},
+		{0.25, []string{"atempo=0.5", "atempo=0.5000"}},
+	}
+
+	for _, tt := range tests {
+		if got := atempoChain(tt.speed); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("atempoChain(%v) = %v, want %v", tt.speed, got, tt.want)
+		}
+	}
+}
+
+func TestFilterGraphArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(g *filterGraph)
+		want  []string
+	}{
+		{
+			name:  "untouched streams are mapped directly",
+			build: func(g *filterGraph) {},
+			want:  []string{"-map", "0:v:0", "-map", "0:a:0?", "-c:a", "copy"},
+		},
+		{
+			name: "linear filters",
+			build: func(g *filterGraph) {
+				g.video = append(g.video, "hflip")
+				g.audio = append(g.audio, "volume=3.0dB")
+			},
+			want: []string{
+				"-filter_complex", "[0:v:0]hflip[v1];[0:a:0]volume=3.0dB[a2]",
+				"-map", "[v1]", "-map", "[a2]", "-c:a", "aac", "-b:a", "128k",
+			},
+		},
+		{
+			name: "cut without audio",
+			build: func(g *filterGraph) {
+				g.noAudio = true
+				g.cut([]validators.TimeRange{{Start: 0, End: 1}, {Start: 2, End: 3}}, 0)
+			},
+			want: []string{
+				"-filter_complex", "[0:v:0]split=2[vs1][vs2];" +
+					"[vs1]trim=start=0.000:end=1.000,setpts=PTS-STARTPTS[vt3];" +
+					"[vs2]trim=start=2.000:end=3.000,setpts=PTS-STARTPTS[vt4];" +
+					"[vt3][vt4]concat=n=2:v=1:a=0[vc5]",
+				"-map", "[vc5]", "-an",
+			},
+		},
+		{
+			name: "cut keeps audio in sync",
+			build: func(g *filterGraph) {
+				g.cut([]validators.TimeRange{{Start: 0, End: 1}, {Start: 2, End: 3}}, 0)
+			},
+			want: []string{
+				"-filter_complex", "[0:v:0]split=2[vs1][vs2];" +
+					"[0:a:0]asplit=2[as3][as4];" +
+					"[vs1]trim=start=0.000:end=1.000,setpts=PTS-STARTPTS[vt5];" +
+					"[as3]atrim=start=0.000:end=1.000,asetpts=PTS-STARTPTS[at6];" +
+					"[vs2]trim=start=2.000:end=3.000,setpts=PTS-STARTPTS[vt7];" +
+					"[as4]atrim=start=2.000:end=3.000,asetpts=PTS-STARTPTS[at8];" +
+					"[vt5][at6][vt7][at8]concat=n=2:v=1:a=1[vc9][ac10]",
+				"-map", "[vc9]", "-map", "[ac10]", "-c:a", "aac", "-b:a", "128k",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFilterGraph()
+			tt.build(g)
+
+			if got := g.args(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// How far back from the requested point keyframes are looked for. Videos
+// with longer GOPs than this can't be fast trimmed
+const keyframeSearchWindow = 60.0
+
+// GetKeyframeBefore inspects the video packets around t and returns the
+// timestamp of the last keyframe at or before it
+func GetKeyframeBefore(p string, t float64) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	zap.L().Debug("Running FFprobe to find keyframes", zap.Float64("before", t))
+
+	interval := fmt.Sprintf("%f%%%f", max(0, t-keyframeSearchWindow), t+1)
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-read_intervals", interval,
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		"-i", p,
+	)
+
+	var stdOut, stdErr bytes.Buffer
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffprobe failed, %w (%s)", err, stdErr.String())
+	}
+
+	found := false
+	keyframe := 0.0
+
+	scanner := bufio.NewScanner(&stdOut)
+	for scanner.Scan() {
+		ptsStr, flags, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if !ok || !strings.Contains(flags, "K") {
+			continue
+		}
+
+		pts, err := strconv.ParseFloat(ptsStr, 64)
+		if err != nil {
+			continue
+		}
+
+		// Timestamps get rounded so allow for a tiny bit of error
+		if pts <= t+0.001 && pts >= keyframe {
+			keyframe = pts
+			found = true
+		}
+	}
+
+	if !found {
+		return 0, errors.New("no keyframe found before the requested point")
+	}
+
+	return keyframe, nil
+}
+
+// AlignToKeyframe moves the trim start of a fast trim back to the closest
+// keyframe so the video can be stream copied. Returns how many seconds
+// earlier the cut starts than requested. The end is cut at the requested
+// point as copied packets don't need to end on a keyframe
+func AlignToKeyframe(opts *validators.ProcessingOptions, p string) (float64, error) {
+	if !opts.FastTrim || opts.TrimStart <= 0 {
+		return 0, nil
+	}
+
+	keyframe, err := GetKeyframeBefore(p, opts.TrimStart)
+	if err != nil {
+		return 0, err
+	}
+
+	shift := opts.TrimStart - keyframe
+	opts.TrimStart = keyframe
+
+	return shift, nil
+}
+
+// makeFastTrimFlags stream copies the trimmed range. The start must
+// already be aligned to a keyframe with AlignToKeyframe
+func makeFastTrimFlags(opts *validators.ProcessingOptions, p string) ([]string, float64, error) {
+	duration := opts.TrimEnd - opts.TrimStart
+
+	args := []string{
+		"-ss", strconv.FormatFloat(opts.TrimStart, 'f', -1, 64),
+		"-t", strconv.FormatFloat(duration, 'f', -1, 64),
+		"-i", p,
+		"-map", "0:v:0",
+		"-map", "0:a?",
+		"-c", "copy",
+		"-avoid_negative_ts", "make_zero",
+	}
+
+	return append(args, pipeOutputFlags()...), duration, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RenderLoop renders a single play of a looped clip to a temporary file and
+// stores its path in the options. The output then reads that file multiple
+// times with -stream_loop, which unlike the loop filter doesn't keep every
+// frame in memory. The caller has to remove the file once the job is done.
+// Errors wrapping ErrInvalidOptions or ErrTooLongToBuffer are the user's to
+// fix
+func RenderLoop(ctx context.Context, opts *validators.ProcessingOptions, p, userID string, j *JobQueue) error {
+	if opts.FastTrim || opts.Loop <= 1 || opts.IsAudioOnly() {
+		return nil
+	}
+
+	args, g, duration, err := makeClipFlags(opts, p)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "loop-*.mkv")
+	if err != nil {
+		return fmt.Errorf("failed to create loop file: %w", err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*10)
+	defer cancel()
+
+	// The clip is stored losslessly so it's only compressed once, by the
+	// encoder of the output
+	args = append(args, g.args()...)
+	args = append(args, "-c:v", "ffv1", "-f", "matroska")
+	args = append(args, pipeFlags()...)
+
+	done := make(chan error, 1)
+	err = j.Enqueue(&FFmpegJob{
+		ID:       util.RandStr(5),
+		UserID:   userID,
+		Output:   f,
+		UseGPU:   true,
+		Args:     &args,
+		Duration: duration,
+		Ctx:      ctx,
+		Done:     done,
+	})
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	opts.LoopPath = f.Name()
+
+	return nil
+}
+
+// loopInputFlags reads the clip rendered by RenderLoop as many times as it
+// should be played and returns the duration of all plays together
+func loopInputFlags(opts *validators.ProcessingOptions) ([]string, *filterGraph, float64, error) {
+	if opts.LoopPath == "" {
+		return nil, nil, 0, errors.New("clip wasn't rendered before looping")
+	}
+
+	streams, err := ProbeStreams(opts.LoopPath)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+	}
+
+	duration, err := GetDuration(opts.LoopPath)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+	}
+
+	// The clip already went through the audio filters, including dropping
+	// the audio if it had to be
+	g := newFilterGraph()
+	g.noAudio = CountStreams(streams, "audio") == 0
+
+	args := []string{
+		"-stream_loop", strconv.Itoa(opts.Loop - 1),
+		"-i", opts.LoopPath,
+	}
+
+	return args, g, duration * float64(opts.Loop), nil
+}
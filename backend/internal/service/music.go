@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"fmt"
+)
+
+// addMusicFilters adds the background music to the output of the provided
+// duration. It runs after the time filters so the music isn't cut, sped up
+// or reversed together with the video. The original audio was already
+// dropped by addAudioFilters if the music replaces it
+func addMusicFilters(g *filterGraph, opts *validators.ProcessingOptions, duration float64) error {
+	if opts.MusicPath == "" {
+		return nil
+	}
+
+	// Probed once by FetchOverlays
+	if !opts.MusicHasAudio {
+		return errors.New("music wasn't checked for audio")
+	}
+
+	// The demuxer is forced and only local files can be opened so a crafted
+	// file can't make ffmpeg read anything else
+	var args []string
+	if opts.MusicOffset < 0 {
+		args = append(args, "-ss", util.FloatToTimestamp(-opts.MusicOffset))
+	}
+
+	if opts.MusicFormat != "" {
+		args = append(args, "-f", opts.MusicFormat)
+	}
+
+	args = append(args, "-protocol_whitelist", "file", "-i", opts.MusicPath)
+	in := g.input(args...)
+
+	filters := []string{"aformat=sample_rates=48000:channel_layouts=stereo"}
+	if opts.MusicVolume != 0 {
+		filters = append(filters, fmt.Sprintf("volume=%.1fdB", opts.MusicVolume))
+	}
+
+	if opts.MusicOffset > 0 {
+		filters = append(filters, fmt.Sprintf("adelay=delays=%d:all=1", int(opts.MusicOffset*1000)))
+	}
+
+	filters = append(filters, fmt.Sprintf("atrim=duration=%.3f", duration))
+
+	music := g.label("m")
+	g.chains = append(g.chains, chain([]string{fmt.Sprintf("%d:a:0", in)}, filters, music))
+
+	// Without the original audio the music is all there is
+	if g.noAudio {
+		g.noAudio = false
+		g.audioIn, g.audio = []string{music}, nil
+		return nil
+	}
+
+	if opts.OriginalVolume != 0 {
+		g.audio = append(g.audio, fmt.Sprintf("volume=%.1fdB", opts.OriginalVolume))
+	}
+
+	g.audio = append(g.audio, "aformat=sample_rates=48000:channel_layouts=stereo")
+	original := g.flushAudio()
+
+	if opts.Ducking {
+		// The original audio is the sidechain that pushes the music down
+		mixIn, sidechain := g.label("o"), g.label("sc")
+		g.chains = append(g.chains, chain([]string{original}, []string{"asplit=2"}, mixIn, sidechain))
+
+		ducked := g.label("md")
+		g.chains = append(g.chains, chain([]string{music, sidechain}, []string{
+			"sidechaincompress=threshold=0.03:ratio=8:attack=20:release=400",
+		}, ducked))
+
+		original, music = mixIn, ducked
+	}
+
+	// The original audio decides the length and keeps its volume
+	g.audioIn = []string{original, music}
+	g.audio = []string{"amix=inputs=2:duration=first:dropout_transition=0:normalize=0"}
+
+	return nil
+}
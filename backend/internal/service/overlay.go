@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"fmt"
+)
+
+var fontFamilies = map[string]string{
+	"sans":  "Sans",
+	"serif": "Serif",
+	"mono":  "Monospace",
+}
+
+// frameSize returns the size of the video after it was cropped, rotated
+// and reframed
+func frameSize(opts *validators.ProcessingOptions, video *ProbeStream) (w, h int) {
+	w, h = orientedSize(opts, video)
+	return reframeSize(opts, w, h)
+}
+
+// orientedSize returns the size of the video after it was cropped and rotated
+func orientedSize(opts *validators.ProcessingOptions, video *ProbeStream) (w, h int) {
+	w, h = video.DisplaySize()
+
+	if opts.ShouldCrop {
+		w, h = opts.CropW, opts.CropH
+	}
+
+	if opts.Rotate == 90 || opts.Rotate == 270 {
+		w, h = h, w
+	}
+
+	return w, h
+}
+
+// overlayPosition returns the x and y expressions placing an overlay of
+// size w*h on a frame of size W*H. The sizes are the names of the variables
+// the filter provides
+func overlayPosition(position string, margin int, W, H, w, h string) (x, y string) {
+	left := fmt.Sprintf("%d", margin)
+	right := fmt.Sprintf("%s-%s-%d", W, w, margin)
+	centerX := fmt.Sprintf("(%s-%s)/2", W, w)
+	top := fmt.Sprintf("%d", margin)
+	bottom := fmt.Sprintf("%s-%s-%d", H, h, margin)
+	centerY := fmt.Sprintf("(%s-%s)/2", H, h)
+
+	switch position {
+	case "top-left":
+		return left, top
+	case "top-right":
+		return right, top
+	case "bottom-left":
+		return left, bottom
+	case "top":
+		return centerX, top
+	case "center":
+		return centerX, centerY
+	case "bottom":
+		return centerX, bottom
+	}
+
+	return right, bottom
+}
+
+// addOverlayFilters draws the watermark and text on top of the video
+func addOverlayFilters(g *filterGraph, opts *validators.ProcessingOptions, video *ProbeStream) {
+	if opts.WatermarkPath != "" {
+		w, _ := frameSize(opts, video)
+		width := max(2, int(float64(w)*opts.WatermarkScale)&^1)
+
+		in := g.input("-i", opts.WatermarkPath)
+		wm := g.label("wm")
+		g.chains = append(g.chains, chain([]string{fmt.Sprintf("%d:v:0", in)}, []string{
+			fmt.Sprintf("scale=%d:-2", width),
+			"format=rgba",
+			fmt.Sprintf("colorchannelmixer=aa=%.2f", opts.WatermarkOpacity),
+		}, wm))
+
+		x, y := overlayPosition(opts.WatermarkPosition, opts.WatermarkMargin, "W", "H", "w", "h")
+
+		g.videoIn = []string{g.flushVideo(), wm}
+		g.video = []string{fmt.Sprintf("overlay=x=%s:y=%s", x, y)}
+	}
+
+	if opts.Text != "" {
+		x, y := overlayPosition(opts.TextPosition, opts.TextSize/2, "w", "h", "text_w", "text_h")
+
+		// The input was already trimmed so the range has to be moved with it
+		offset := max(opts.TrimStart, 0)
+		enable := fmt.Sprintf("gte(t,%.3f)", opts.TextStart-offset)
+		if opts.TextEnd > 0 {
+			enable = fmt.Sprintf("between(t,%.3f,%.3f)", opts.TextStart-offset, opts.TextEnd-offset)
+		}
+
+		g.video = append(g.video, fmt.Sprintf(
+			"drawtext=font=%s:text=%s:expansion=none:fontsize=%d:fontcolor=white:borderw=2:bordercolor=black:x=%s:y=%s:enable='%s'",
+			escapeFilterValue(fontFamilies[opts.TextFont]),
+			escapeFilterValue(opts.Text),
+			opts.TextSize,
+			x, y,
+			enable,
+		))
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bitwise74/video-api/db"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// FetchOverlays downloads the saved music and watermark the options refer
+// to and fills in their paths, then makes sure the music has audio. The
+// returned func removes the downloads and has to be called even if an error
+// is returned. The status code tells if the error is the user's fault
+func FetchOverlays(ctx context.Context, d *db.DB, opts *validators.ProcessingOptions, userID string) (func(), int, error) {
+	var paths []string
+	cleanup := func() {
+		for _, p := range paths {
+			os.Remove(p)
+		}
+	}
+
+	if opts.MusicID != 0 {
+		key, err := d.FetchAudioKey(userID, opts.MusicID)
+		if err != nil {
+			return cleanup, http.StatusInternalServerError, fmt.Errorf("failed to fetch music from db: %w", err)
+		}
+
+		if key == "" {
+			return cleanup, http.StatusNotFound, errors.New("Music not found")
+		}
+
+		p, err := DownloadFile(ctx, key)
+		if err != nil {
+			return cleanup, http.StatusInternalServerError, fmt.Errorf("failed to download music: %w", err)
+		}
+
+		paths = append(paths, p)
+		opts.MusicPath = p
+
+		f, err := os.Open(p)
+		if err != nil {
+			return cleanup, http.StatusInternalServerError, fmt.Errorf("failed to open music: %w", err)
+		}
+
+		opts.MusicFormat, err = validators.MusicFormat(f)
+		f.Close()
+
+		if errors.Is(err, validators.ErrMusicUnsupported) {
+			return cleanup, http.StatusBadRequest, err
+		}
+
+		if err != nil {
+			return cleanup, http.StatusInternalServerError, fmt.Errorf("failed to check music format: %w", err)
+		}
+	}
+
+	if opts.Watermark {
+		hash, err := d.FetchWatermarkHash(userID)
+		if err != nil {
+			return cleanup, http.StatusInternalServerError, fmt.Errorf("failed to fetch watermark from db: %w", err)
+		}
+
+		if hash == "" {
+			return cleanup, http.StatusBadRequest, errors.New("Upload a watermark in your settings first")
+		}
+
+		p, err := DownloadFile(ctx, "watermarks/"+hash)
+		if err != nil {
+			return cleanup, http.StatusInternalServerError, fmt.Errorf("failed to download watermark: %w", err)
+		}
+
+		paths = append(paths, p)
+		opts.WatermarkPath = p
+	}
+
+	// Checked here for uploaded music too, so the user gets told right away
+	// instead of the job failing
+	if opts.MusicPath != "" {
+		streams, err := ProbeStreams(opts.MusicPath)
+		if err != nil {
+			return cleanup, http.StatusInternalServerError, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+		}
+
+		if CountStreams(streams, "audio") == 0 {
+			return cleanup, http.StatusBadRequest, errors.New("Music file has no audio")
+		}
+
+		opts.MusicHasAudio = true
+	}
+
+	return cleanup, http.StatusOK, nil
+}
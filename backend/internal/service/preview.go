@@ -0,0 +1,102 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	previewClips      = 5
+	previewClipLength = 1.2 // In seconds
+	previewWidth      = 320
+	previewFPS        = 15
+)
+
+// MakePreview renders a short muted clip made of a few moments from across
+// the video, meant to be played when hovering over it. Short videos are
+// used from the start instead. Callers must remove the returned file
+func MakePreview(ctx context.Context, p, userID string, j *JobQueue) (string, error) {
+	duration, err := GetDuration(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+	}
+
+	encoder := os.Getenv("FFMPEG_ENCODER")
+	if encoder == "" {
+		encoder = "libx264"
+	}
+
+	format := fmt.Sprintf("scale=%d:-2,fps=%d,setsar=1,format=yuv420p", previewWidth, previewFPS)
+
+	args := []string{"-loglevel", "error"}
+
+	if duration < previewClips*previewClipLength*2 {
+		args = append(args,
+			"-t", util.FloatToTimestamp(previewClips*previewClipLength),
+			"-i", p,
+			"-vf", format,
+		)
+	} else {
+		// Every clip is its own input so seeking skips the parts in between
+		var chains, concatIn []string
+
+		for i := range previewClips {
+			at := duration * (float64(i) + 0.5) / previewClips
+
+			args = append(args,
+				"-ss", util.FloatToTimestamp(at),
+				"-t", util.FloatToTimestamp(previewClipLength),
+				"-i", p,
+			)
+
+			out := "p" + strconv.Itoa(i)
+			chains = append(chains, chain([]string{fmt.Sprintf("%d:v:0", i)}, []string{format}, out))
+			concatIn = append(concatIn, out)
+		}
+
+		chains = append(chains, chain(concatIn, []string{fmt.Sprintf("concat=n=%d:v=1:a=0", previewClips)}, "vout"))
+
+		args = append(args, "-filter_complex", strings.Join(chains, ";"), "-map", "[vout]")
+	}
+
+	previewPath := path.Join(os.TempDir(), util.RandStr(10)+".mp4")
+
+	args = append(args,
+		"-an",
+		"-c:v", encoder,
+		"-b:v", "300k",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		previewPath,
+	)
+
+	done := make(chan error, 1)
+	err = j.Enqueue(&FFmpegJob{
+		ID:         util.RandStr(5),
+		UserID:     userID,
+		Args:       &args,
+		Ctx:        ctx,
+		Done:       done,
+		Background: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			os.Remove(previewPath)
+			return "", err
+		}
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	return previewPath, nil
+}
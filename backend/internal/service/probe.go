@@ -0,0 +1,157 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type ProbeStream struct {
+	Index     int    `json:"index"`
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Channels  int    `json:"channels"`
+
+	AvgFrameRate string `json:"avg_frame_rate"`
+
+	ColorTransfer  string `json:"color_transfer"`
+	ColorPrimaries string `json:"color_primaries"`
+	ColorSpace     string `json:"color_space"`
+
+	Tags struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// Rotation returns the clockwise rotation needed to display the stream
+// upright. Newer files use display matrix side data while older ones have
+// a rotate tag
+func (s ProbeStream) Rotation() int {
+	for _, sd := range s.SideDataList {
+		if r := int(math.Round(sd.Rotation)); r != 0 {
+			return ((-r % 360) + 360) % 360
+		}
+	}
+
+	if r, err := strconv.Atoi(s.Tags.Rotate); err == nil {
+		return ((r % 360) + 360) % 360
+	}
+
+	return 0
+}
+
+// DisplaySize returns the dimensions of the stream after it's rotated
+func (s ProbeStream) DisplaySize() (w, h int) {
+	if r := s.Rotation(); r == 90 || r == 270 {
+		return s.Height, s.Width
+	}
+
+	return s.Width, s.Height
+}
+
+// FrameRate parses the average frame rate of the stream, which ffprobe
+// reports as a fraction. Returns 0 if it's unknown
+func (s ProbeStream) FrameRate() float64 {
+	num, den, ok := strings.Cut(s.AvgFrameRate, "/")
+	if !ok {
+		return 0
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+
+	return n / d
+}
+
+// IsHDR reports if the stream uses an HDR transfer function, either PQ
+// (HDR10, Dolby Vision) or HLG
+func (s ProbeStream) IsHDR() bool {
+	return s.ColorTransfer == "smpte2084" || s.ColorTransfer == "arib-std-b67"
+}
+
+type probeResult struct {
+	Streams []ProbeStream `json:"streams"`
+}
+
+// ProbeStreams runs ffprobe to list all streams inside of a media file
+func ProbeStreams(p string) ([]ProbeStream, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	zap.L().Debug("Running FFprobe to list streams")
+
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_streams", "-of", "json", "-i", p)
+
+	var stdOut, stdErr bytes.Buffer
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe failed, %w (%s)", err, stdErr.String())
+	}
+
+	var res probeResult
+	if err := json.Unmarshal(stdOut.Bytes(), &res); err != nil {
+		return nil, fmt.Errorf("malformed ffprobe output: %w", err)
+	}
+
+	return res.Streams, nil
+}
+
+// FirstStream returns the first stream of the provided type or nil if there's none
+func FirstStream(streams []ProbeStream, codecType string) *ProbeStream {
+	for i := range streams {
+		if streams[i].CodecType == codecType {
+			return &streams[i]
+		}
+	}
+
+	return nil
+}
+
+// CountStreams returns how many streams of the provided type (video, audio, subtitle) exist
+func CountStreams(streams []ProbeStream, codecType string) (n int) {
+	for _, s := range streams {
+		if s.CodecType == codecType {
+			n++
+		}
+	}
+
+	return n
+}
+
+// GetVideoStream returns the first video stream in a file
+func GetVideoStream(p string) (*ProbeStream, error) {
+	streams, err := ProbeStreams(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s := FirstStream(streams, "video")
+	if s == nil {
+		return nil, errors.New("no video stream found")
+	}
+
+	return s, nil
+}
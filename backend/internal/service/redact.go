@@ -0,0 +1,53 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"fmt"
+)
+
+// addRedactionFilters hides every redaction box while its time range is
+// playing. Solid boxes are drawn directly while blurred and pixelated ones
+// are cut out, filtered and overlaid back on top of the frame
+func addRedactionFilters(g *filterGraph, opts *validators.ProcessingOptions, video *ProbeStream) error {
+	w, h := video.DisplaySize()
+
+	// The input was already trimmed so the ranges have to be moved with it
+	offset := max(opts.TrimStart, 0)
+
+	for _, r := range opts.Redactions {
+		if r.X+r.W > w || r.Y+r.H > h {
+			return fmt.Errorf("%w, redaction box %dx%d+%d+%d is outside of the %dx%d frame", ErrInvalidOptions, r.W, r.H, r.X, r.Y, w, h)
+		}
+
+		enable := fmt.Sprintf("gte(t,%.3f)", r.Start-offset)
+		if r.End > 0 {
+			enable = fmt.Sprintf("between(t,%.3f,%.3f)", r.Start-offset, r.End-offset)
+		}
+
+		if r.Mode == "solid" {
+			g.video = append(g.video, fmt.Sprintf("drawbox=x=%d:y=%d:w=%d:h=%d:color=black:t=fill:enable='%s'", r.X, r.Y, r.W, r.H, enable))
+			continue
+		}
+
+		filters := []string{fmt.Sprintf("crop=%d:%d:%d:%d", r.W, r.H, r.X, r.Y)}
+		if r.Mode == "pixelate" {
+			filters = append(filters,
+				fmt.Sprintf("scale=%d:%d", max(1, r.W/16), max(1, r.H/16)),
+				fmt.Sprintf("scale=%d:%d:flags=neighbor", r.W, r.H),
+			)
+		} else {
+			filters = append(filters, "gblur=sigma=20")
+		}
+
+		base, box, hidden := g.label("rb"), g.label("rs"), g.label("rh")
+		g.chains = append(g.chains,
+			chain([]string{g.flushVideo()}, []string{"split"}, base, box),
+			chain([]string{box}, filters, hidden),
+		)
+
+		g.videoIn = []string{base, hidden}
+		g.video = []string{fmt.Sprintf("overlay=x=%d:y=%d:enable='%s'", r.X, r.Y, enable)}
+	}
+
+	return nil
+}
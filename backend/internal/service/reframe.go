@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"fmt"
+)
+
+var reframeRatios = map[string][2]int{
+	"9:16": {9, 16},
+	"1:1":  {1, 1},
+	"4:5":  {4, 5},
+}
+
+// reframeSize returns the size of a w*h frame after it's reframed. Crop mode
+// cuts out the biggest window of the ratio that fits. Blur mode keeps the
+// short side of the frame and extends the other one
+func reframeSize(opts *validators.ProcessingOptions, w, h int) (int, int) {
+	ratio, ok := reframeRatios[opts.Reframe]
+	if !ok {
+		return w, h
+	}
+
+	rw, rh := ratio[0], ratio[1]
+
+	if opts.ReframeMode == "blur" {
+		short := min(w, h) &^ 1
+		return short, (short * rh / rw) &^ 1
+	}
+
+	if w*rh > h*rw {
+		return (h * rw / rh) &^ 1, h &^ 1
+	}
+
+	return w &^ 1, (w * rh / rw) &^ 1
+}
+
+// keyframeExpr builds an expression that interpolates the keyframe values
+// linearly over time. Values are held before the first and after the last
+// keyframe
+func keyframeExpr(times, values []float64) string {
+	n := len(values)
+	if n == 0 {
+		return "0.5"
+	}
+
+	expr := fmt.Sprintf("%.4f", values[n-1])
+	for i := n - 2; i >= 0; i-- {
+		lerp := fmt.Sprintf("%.4f+(%.4f)*(t-%.3f)/%.3f", values[i], values[i+1]-values[i], times[i], times[i+1]-times[i])
+		expr = fmt.Sprintf("if(lt(t,%.3f),%s,%s)", times[i+1], lerp, expr)
+	}
+
+	return fmt.Sprintf("if(lt(t,%.3f),%.4f,%s)", times[0], values[0], expr)
+}
+
+// addReframeFilters changes the aspect ratio of a w*h frame. It runs after
+// cropping and rotating so keyframes match the frame the user sees
+func addReframeFilters(g *filterGraph, opts *validators.ProcessingOptions, w, h int) {
+	if opts.Reframe == "" {
+		return
+	}
+
+	ow, oh := reframeSize(opts, w, h)
+
+	if opts.ReframeMode == "blur" {
+		bgIn, fgIn := g.label("bg"), g.label("fg")
+		g.chains = append(g.chains, chain([]string{g.flushVideo()}, []string{"split=2"}, bgIn, fgIn))
+
+		bg, fg := g.label("bg"), g.label("fg")
+		g.chains = append(g.chains,
+			chain([]string{bgIn}, []string{
+				fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase", ow, oh),
+				fmt.Sprintf("crop=%d:%d", ow, oh),
+				"gblur=sigma=30",
+				"setsar=1",
+			}, bg),
+			chain([]string{fgIn}, []string{
+				fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2", ow, oh),
+				"setsar=1",
+			}, fg),
+		)
+
+		g.videoIn = []string{bg, fg}
+		g.video = []string{"overlay=x=(W-w)/2:y=(H-h)/2"}
+		return
+	}
+
+	// The input was already trimmed so the keyframes have to be moved with it
+	offset := max(opts.TrimStart, 0)
+
+	var times, xs, ys []float64
+	for _, k := range opts.ReframeKeyframes {
+		times = append(times, k.Time-offset)
+		xs = append(xs, k.X)
+		ys = append(ys, k.Y)
+	}
+
+	// Crop evaluates the position for every frame so the window follows
+	// the keyframes
+	g.video = append(g.video, fmt.Sprintf(
+		"crop=w=%d:h=%d:x='clip(%s*iw-ow/2,0,iw-ow)':y='clip(%s*ih-oh/2,0,ih-oh)'",
+		ow, oh,
+		keyframeExpr(times, xs),
+		keyframeExpr(times, ys),
+	))
+}
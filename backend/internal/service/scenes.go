@@ -0,0 +1,83 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scene changes closer than this to the previous one are ignored so fast
+// cuts don't turn into a pile of chapters
+const minSceneGap = 5.0
+
+// DetectScenes returns the timestamps where the picture changes by more
+// than threshold (0-1), which make good chapter markers
+func DetectScenes(ctx context.Context, p string, threshold float64, userID string, j *JobQueue) ([]float64, error) {
+	var out bytes.Buffer
+
+	done := make(chan error, 1)
+	err := j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Output: &out,
+		Args: &[]string{
+			"-loglevel", "error",
+			"-i", p,
+			"-an",
+			// Scores are computed on small frames, which is much faster and
+			// barely changes the result
+			"-vf", fmt.Sprintf("scale=320:-2,select='gt(scene,%.2f)',metadata=mode=print:file=-", threshold),
+			"-f", "null",
+			"-",
+		},
+		Ctx:        ctx,
+		Done:       done,
+		NoProgress: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	scenes := []float64{}
+
+	// Frames are printed like "frame:0 pts:1234 pts_time:1.234"
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		for field := range strings.FieldsSeq(scanner.Text()) {
+			v, ok := strings.CutPrefix(field, "pts_time:")
+			if !ok {
+				continue
+			}
+
+			t, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+
+			if len(scenes) > 0 && t-scenes[len(scenes)-1] < minSceneGap {
+				continue
+			}
+
+			if len(scenes) == 0 && t < minSceneGap {
+				continue
+			}
+
+			scenes = append(scenes, t)
+		}
+	}
+
+	return scenes, nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrAllSilent is returned when removing silence wouldn't leave anything
+var ErrAllSilent = errors.New("the whole clip is silent")
+
+// DetectSilence returns the ranges between start and end (0 means until the
+// end) where the audio stays below noise dB for at least minDuration seconds
+func DetectSilence(ctx context.Context, p string, noise, minDuration, start, end float64, userID string, j *JobQueue) (validators.TimeRanges, error) {
+	streams, err := ProbeStreams(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+	}
+
+	// There's nothing to detect without audio and ffmpeg would fail
+	if CountStreams(streams, "audio") == 0 {
+		return validators.TimeRanges{}, nil
+	}
+
+	args := []string{"-loglevel", "error"}
+	if start > 0 {
+		args = append(args, "-ss", util.FloatToTimestamp(start))
+	}
+
+	if end > 0 {
+		args = append(args, "-t", util.FloatToTimestamp(end-start))
+	}
+
+	args = append(args,
+		"-i", p,
+		"-vn",
+		"-af", fmt.Sprintf("silencedetect=n=%.1fdB:d=%.2f,ametadata=mode=print:file=-", noise, minDuration),
+		"-f", "null",
+		"-",
+	)
+
+	var stdOut bytes.Buffer
+
+	done := make(chan error, 1)
+	err = j.Enqueue(&FFmpegJob{
+		ID:         util.RandStr(5),
+		UserID:     userID,
+		Output:     &stdOut,
+		Args:       &args,
+		Ctx:        ctx,
+		Done:       done,
+		NoProgress: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ranges := validators.TimeRanges{}
+	open := -1.0
+
+	// The timestamps start at 0 when the input is trimmed
+	scanner := bufio.NewScanner(&stdOut)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		t, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+
+		switch key {
+		case "lavfi.silence_start":
+			open = max(t, 0) + start
+		case "lavfi.silence_end":
+			if open >= 0 {
+				ranges = append(ranges, validators.TimeRange{Start: open, End: t + start})
+				open = -1
+			}
+		}
+	}
+
+	// Silence that lasts until the end is never closed
+	if open >= 0 {
+		if end <= 0 {
+			duration, err := GetDuration(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+			}
+
+			end = duration
+		}
+
+		if end > open {
+			ranges = append(ranges, validators.TimeRange{Start: open, End: end})
+		}
+	}
+
+	return ranges, nil
+}
+
+// RemoveSilences turns the silent parts of a video into segments that are
+// cut out of the job. Each silence keeps a bit of padding on both sides so
+// speech doesn't get clipped. Only the longest silences are cut if there are
+// too many to fit in one job. Returns how many seconds get removed or
+// ErrAllSilent if nothing would be left
+func RemoveSilences(ctx context.Context, opts *validators.ProcessingOptions, p, userID string, j *JobQueue) (float64, error) {
+	if !opts.RemoveSilence {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	start, end := max(opts.TrimStart, 0), opts.TrimEnd
+	if end <= 0 {
+		duration, err := GetDuration(p)
+		if err != nil {
+			return 0, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+		}
+
+		end = duration
+	}
+
+	silences, err := DetectSilence(ctx, p, opts.SilenceThreshold, opts.SilenceMinDuration, start, end, userID, j)
+	if err != nil {
+		return 0, err
+	}
+
+	segments := validators.TimeRanges{}
+	for _, s := range silences {
+		r := validators.TimeRange{
+			Start: s.Start + opts.SilencePadding,
+			End:   s.End - opts.SilencePadding,
+		}
+
+		if r.End > r.Start {
+			segments = append(segments, r)
+		}
+	}
+
+	// Every cut adds a branch to the filter graph
+	if len(segments) > validators.MaxSegments {
+		slices.SortFunc(segments, func(a, b validators.TimeRange) int {
+			return cmp.Compare(b.End-b.Start, a.End-a.Start)
+		})
+
+		segments = segments[:validators.MaxSegments]
+		slices.SortFunc(segments, func(a, b validators.TimeRange) int {
+			return cmp.Compare(a.Start, b.Start)
+		})
+	}
+
+	if segments.Invert(start, end).Duration() <= 0 {
+		return 0, ErrAllSilent
+	}
+
+	opts.Segments = segments
+	opts.SegmentMode = "remove"
+
+	return segments.Duration(), nil
+}
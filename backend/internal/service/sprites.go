@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	spriteColumns     = 10
+	spriteTileWidth   = 160
+	maxSpriteTiles    = 100
+	minSpriteInterval = 2.0 // In seconds
+)
+
+// MakeSprites renders a sheet of frames taken every few seconds and a
+// WebVTT file that maps each time range to its tile, as used by players
+// for previews on the timeline. The cues point at sheetName relative to
+// the WebVTT file. Callers must remove both returned files
+func MakeSprites(ctx context.Context, p, sheetName, userID string, j *JobQueue) (vttPath, sheetPath string, err error) {
+	duration, err := GetDuration(p)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
+	}
+
+	streams, err := ProbeStreams(p)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to run ffprobe to list streams: %w", err)
+	}
+
+	video := FirstStream(streams, "video")
+	if video == nil {
+		return "", "", errors.New("no video stream found")
+	}
+
+	w, h := video.DisplaySize()
+	if w <= 0 || h <= 0 {
+		return "", "", errors.New("video has no size")
+	}
+
+	tileW := spriteTileWidth
+	tileH := max(2, int(math.Round(float64(tileW*h)/float64(w)/2))*2)
+
+	// Long videos get fewer frames per second so they fit on one sheet
+	interval := max(minSpriteInterval, duration/maxSpriteTiles)
+	count := max(1, int(math.Ceil(duration/interval)))
+	rows := (count + spriteColumns - 1) / spriteColumns
+
+	sheetPath = path.Join(os.TempDir(), util.RandStr(10)+path.Ext(sheetName))
+
+	done := make(chan error, 1)
+	err = j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Args: &[]string{
+			"-loglevel", "error",
+			// Only keyframes are decoded which is a lot faster and close enough
+			"-skip_frame", "nokey",
+			"-i", p,
+			"-vf", fmt.Sprintf("fps=1/%.4f,scale=%d:%d,tile=%dx%d", interval, tileW, tileH, spriteColumns, rows),
+			"-frames:v", "1",
+			"-q:v", "70",
+			sheetPath,
+		},
+		Ctx:        ctx,
+		Done:       done,
+		Background: true,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			os.Remove(sheetPath)
+			return "", "", err
+		}
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+
+	for i := range count {
+		start := float64(i) * interval
+		end := min(start+interval, duration)
+
+		fmt.Fprintf(&vtt, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			util.FloatToTimestamp(start),
+			util.FloatToTimestamp(end),
+			sheetName,
+			(i%spriteColumns)*tileW,
+			(i/spriteColumns)*tileH,
+			tileW,
+			tileH,
+		)
+	}
+
+	vttPath = path.Join(os.TempDir(), util.RandStr(10)+".vtt")
+	if err := os.WriteFile(vttPath, []byte(vtt.String()), 0o600); err != nil {
+		os.Remove(sheetPath)
+		return "", "", fmt.Errorf("failed to write sprite cues, %w", err)
+	}
+
+	return vttPath, sheetPath, nil
+}
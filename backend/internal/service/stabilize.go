@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Stabilizer returns the filter used to stabilize videos, either vidstab or
+// deshake. Empty if the ffmpeg build has neither
+func Stabilizer() string {
+	return os.Getenv("FFMPEG_STABILIZER")
+}
+
+// AnalyzeMotion runs the first pass of vidstab over the trimmed video and
+// stores the path of the transforms in the options. The caller has to
+// remove the file once the job is done. Deshake works in a single pass so
+// there's nothing to do for it
+func AnalyzeMotion(ctx context.Context, opts *validators.ProcessingOptions, p, userID string, j *JobQueue) error {
+	if !opts.Stabilize || Stabilizer() != "vidstab" {
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "transforms-*.trf")
+	if err != nil {
+		return fmt.Errorf("failed to create transforms file: %w", err)
+	}
+	f.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	args := []string{"-loglevel", "error"}
+	if opts.TrimStart > 0 {
+		args = append(args, "-ss", util.FloatToTimestamp(opts.TrimStart))
+	}
+
+	if opts.TrimEnd > 0 {
+		args = append(args, "-t", util.FloatToTimestamp(opts.TrimEnd-max(opts.TrimStart, 0)))
+	}
+
+	// The motion has to be measured on the same frames the transform sees
+	filter := "vidstabdetect=shakiness=5:accuracy=15:result=" + escapeFilterValue(f.Name())
+	if opts.ShouldCrop {
+		filter = fmt.Sprintf("crop=%d:%d:%d:%d,%s", opts.CropW, opts.CropH, opts.CropX, opts.CropY, filter)
+	}
+
+	args = append(args,
+		"-i", p,
+		"-an",
+		"-vf", filter,
+		"-f", "null",
+		"-",
+	)
+
+	zap.L().Debug("Running FFmpeg to analyze motion")
+
+	// vidstabdetect writes the transforms itself so stdout has nothing useful
+	done := make(chan error, 1)
+	err = j.Enqueue(&FFmpegJob{
+		ID:         util.RandStr(5),
+		UserID:     userID,
+		Output:     io.Discard,
+		Args:       &args,
+		Ctx:        ctx,
+		Done:       done,
+		NoProgress: true,
+	})
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	opts.TransformsPath = f.Name()
+
+	return nil
+}
+
+// stabilizeFilters returns the filters that smooth out camera shake. They
+// run right after cropping so the motion matches the analysis pass
+func stabilizeFilters(opts *validators.ProcessingOptions) ([]string, error) {
+	if !opts.Stabilize {
+		return nil, nil
+	}
+
+	switch Stabilizer() {
+	case "vidstab":
+		if opts.TransformsPath == "" {
+			return nil, errors.New("motion wasn't analyzed before stabilizing")
+		}
+
+		// optzoom zooms in just enough to hide the moving borders and
+		// unsharp brings back some of the detail lost to interpolation
+		return []string{
+			"vidstabtransform=input=" + escapeFilterValue(opts.TransformsPath) + ":smoothing=10:optzoom=1",
+			"unsharp=5:5:0.8:3:3:0.4",
+		}, nil
+	case "deshake":
+		return []string{"deshake"}, nil
+	default:
+		return nil, errors.New("ffmpeg has no filters to stabilize videos with")
+	}
+}
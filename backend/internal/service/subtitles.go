@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ConvertToWebVTT converts subtitles read with the given ffmpeg demuxer into
+// WebVTT so they can be used by the player. Returns the path to the converted
+// file. Callers must remember to remove the file after using it
+func ConvertToWebVTT(ctx context.Context, p, format, userID string, j *JobQueue) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*15)
+	defer cancel()
+
+	zap.L().Debug("Converting subtitles to WebVTT")
+
+	tmpFile, err := os.CreateTemp("", "subtitles-*.vtt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for subtitles, %w", err)
+	}
+	tmpFile.Close()
+
+	// The format is forced and only local files can be opened so the
+	// content can't make ffmpeg read anything else
+	done := make(chan error, 1)
+	err = j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Output: io.Discard,
+		Args: &[]string{
+			"-y",
+			"-loglevel", "error",
+			"-f", format,
+			"-protocol_whitelist", "file",
+			"-i", p,
+			"-f", "webvtt",
+			tmpFile.Name(),
+		},
+		Ctx:        ctx,
+		Done:       done,
+		NoProgress: true,
+	})
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("ffmpeg failed to convert subtitles, %w", err)
+	}
+
+	return tmpFile.Name(), nil
+}
+
+var (
+	vttBlockRe     = regexp.MustCompile(`\n{2,}`)
+	vttTimingRe    = regexp.MustCompile(`^(\S+)\s+-->\s+(\S+)(.*)$`)
+	vttTimestampRe = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})$`)
+)
+
+type vttCue struct {
+	start, end float64
+	id         []string
+	settings   string
+	payload    []string
+}
+
+// ShiftCues moves the cues of a WebVTT file to where they end up after the
+// video is processed and drops the ones that start in a part that was cut
+// out. duration is the length of the video before processing. Returns the
+// new file and the amount of cues left in it
+func ShiftCues(vtt string, opts *validators.ProcessingOptions, duration float64) (string, int) {
+	vtt = strings.ReplaceAll(vtt, "\r\n", "\n")
+	blocks := vttBlockRe.Split(strings.TrimSpace(vtt), -1)
+
+	// Styles and regions have to come before the first cue, notes in
+	// between the cues would end up in the wrong place so they're dropped
+	header := []string{}
+	cues := []vttCue{}
+	inCues := false
+
+	speed := 1.0
+	if opts.Speed > 0 {
+		speed = opts.Speed
+	}
+
+	for _, block := range blocks {
+		lines := strings.Split(block, "\n")
+
+		timing := slices.IndexFunc(lines, func(l string) bool { return strings.Contains(l, "-->") })
+		if timing < 0 {
+			if !inCues {
+				header = append(header, block)
+			}
+
+			continue
+		}
+
+		inCues = true
+
+		m := vttTimingRe.FindStringSubmatch(strings.TrimSpace(lines[timing]))
+		if m == nil {
+			continue
+		}
+
+		start, ok := parseVTTTimestamp(m[1])
+		if !ok {
+			continue
+		}
+
+		end, ok := parseVTTTimestamp(m[2])
+		if !ok || end < start {
+			continue
+		}
+
+		// The cue keeps its length, only its start is moved like the
+		// chapters are
+		mapped, ok := MapTime(opts, duration, start)
+		if !ok {
+			continue
+		}
+
+		length := (end - start) / speed
+
+		cue := vttCue{
+			start:    mapped,
+			end:      mapped + length,
+			id:       lines[:timing],
+			settings: m[3],
+			payload:  lines[timing+1:],
+		}
+
+		// Played backwards the start of the cue is where it ends
+		if opts.Reverse {
+			cue.start, cue.end = max(mapped-length, 0), mapped
+		}
+
+		cues = append(cues, cue)
+	}
+
+	slices.SortStableFunc(cues, func(a, b vttCue) int {
+		switch {
+		case a.start < b.start:
+			return -1
+		case a.start > b.start:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	if len(header) == 0 || !strings.HasPrefix(header[0], "WEBVTT") {
+		header = append([]string{"WEBVTT"}, header...)
+	}
+
+	var out strings.Builder
+	out.WriteString(strings.Join(header, "\n\n"))
+	out.WriteString("\n")
+
+	for _, cue := range cues {
+		out.WriteString("\n")
+
+		for _, l := range cue.id {
+			out.WriteString(l + "\n")
+		}
+
+		fmt.Fprintf(&out, "%s --> %s%s\n", util.FloatToTimestamp(cue.start), util.FloatToTimestamp(cue.end), cue.settings)
+
+		for _, l := range cue.payload {
+			out.WriteString(l + "\n")
+		}
+	}
+
+	return out.String(), len(cues)
+}
+
+// parseVTTTimestamp parses a WebVTT timestamp, where the hours are optional,
+// into seconds
+func parseVTTTimestamp(ts string) (float64, bool) {
+	m := vttTimestampRe.FindStringSubmatch(ts)
+	if m == nil {
+		return 0, false
+	}
+
+	var h int
+	if m[1] != "" {
+		h, _ = strconv.Atoi(m[1])
+	}
+
+	mins, _ := strconv.Atoi(m[2])
+	secs, _ := strconv.Atoi(m[3])
+	ms, _ := strconv.Atoi(m[4])
+
+	if mins > 59 || secs > 59 {
+		return 0, false
+	}
+
+	return float64(h*3600+mins*60+secs) + float64(ms)/1000, true
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"testing"
+)
+
+func TestShiftCues(t *testing.T) {
+	in := "WEBVTT\r\n\r\n" +
+		"STYLE\r\n::cue { color: red }\r\n\r\n" +
+		"1\r\n00:00:01.000 --> 00:00:02.500 align:start\r\nHello\r\nthere\r\n\r\n" +
+		"00:05.000 --> 00:06.000\r\nBye\r\n\r\n" +
+		"NOTE dropped\r\n\r\n" +
+		"00:00:09.000 --> 00:00:09.500\r\nEnd\r\n"
+
+	tests := []struct {
+		name  string
+		opts  validators.ProcessingOptions
+		want  string
+		wantN int
+	}{
+		{
+			name: "trimmed",
+			opts: validators.ProcessingOptions{TrimStart: 0.5, TrimEnd: 8},
+			want: "WEBVTT\n\nSTYLE\n::cue { color: red }\n\n" +
+				"1\n00:00:00.500 --> 00:00:02.000 align:start\nHello\nthere\n\n" +
+				"00:00:04.500 --> 00:00:05.500\nBye\n",
+			wantN: 2,
+		},
+		{
+			name: "reversed and sped up",
+			opts: validators.ProcessingOptions{Reverse: true, Speed: 2},
+			want: "WEBVTT\n\nSTYLE\n::cue { color: red }\n\n" +
+				"00:00:00.250 --> 00:00:00.500\nEnd\n\n" +
+				"00:00:02.000 --> 00:00:02.500\nBye\n\n" +
+				"1\n00:00:03.750 --> 00:00:04.500 align:start\nHello\nthere\n",
+			wantN: 3,
+		},
+		{
+			name:  "everything cut",
+			opts:  validators.ProcessingOptions{TrimStart: 9.8},
+			want:  "WEBVTT\n\nSTYLE\n::cue { color: red }\n",
+			wantN: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n := ShiftCues(in, &tt.opts, 10)
+			if n != tt.wantN {
+				t.Errorf("got %d cues, want %d", n, tt.wantN)
+			}
+
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVTTTimestamp(t *testing.T) {
+	tests := []struct {
+		ts     string
+		want   float64
+		wantOK bool
+	}{
+		{"00:00:01.500", 1.5, true},
+		{"01:02:03.004", 3723.004, true},
+		{"02:03.004", 123.004, true},
+		{"100:00:00.000", 360000, true},
+		{"00:60:00.000", 0, false},
+		{"00:00:01,500", 0, false},
+		{"1.5", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseVTTTimestamp(tt.ts)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseVTTTimestamp(%q) = %v, %v, want %v, %v", tt.ts, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -4,22 +4,201 @@ package service
 
 import (
 	"bitwise74/video-api/pkg/util"
+	"bufio"
+	"bytes"
 	"context"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-// MakeThumbnail creates a thumbnail from a multipart.File
+// Points of the video, relative to its duration, that candidate
+// thumbnails are picked around
+var thumbnailCandidates = []float64{0.1, 0.3, 0.5, 0.7, 0.9}
+
+const (
+	minThumbnailBrightness = 24.0  // Average luma, darker frames are treated as black
+	maxThumbnailBrightness = 235.0 // Brighter frames are treated as white
+	minThumbnailContrast   = 16.0  // Luma spread, flatter frames are loading screens and fades
+)
+
+// Part of the 30 seconds budget left for the fallback frame
+const thumbnailFallbackBudget = time.Second * 8
+
+type thumbnailCandidate struct {
+	path       string
+	brightness float64
+	contrast   float64
+	blur       float64
+}
+
+func (c *thumbnailCandidate) usable() bool {
+	return c.brightness >= minThumbnailBrightness &&
+		c.brightness <= maxThumbnailBrightness &&
+		c.contrast >= minThumbnailContrast
+}
+
+// betterThan prefers usable frames and then the sharpest one. When nothing
+// is usable the frame with the most detail wins
+func (c *thumbnailCandidate) betterThan(o *thumbnailCandidate) bool {
+	if c.usable() != o.usable() {
+		return c.usable()
+	}
+
+	if !c.usable() {
+		return c.contrast > o.contrast
+	}
+
+	return c.blur < o.blur
+}
+
+// MakeThumbnail creates a thumbnail from a multipart.File. A few frames are
+// sampled across the video and the best one is kept, skipping black, blank
+// and blurry ones. Falls back to the first frame
 func MakeThumbnail(input, userID string, j *JobQueue) (p string, err error) {
 	zap.L().Debug("Creating thumbnail for video")
 
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	duration, err := GetDuration(input)
+	if err != nil || duration < 2 {
+		return captureFrame(ctx, input, 0, userID, j)
+	}
+
+	sampleCtx, cancelSample := context.WithTimeout(ctx, time.Second*30-thumbnailFallbackBudget)
+	defer cancelSample()
+
+	var best *thumbnailCandidate
+	for _, at := range thumbnailCandidates {
+		c, err := sampleFrame(sampleCtx, input, duration*at, userID, j)
+		if err != nil {
+			if sampleCtx.Err() != nil {
+				break
+			}
+
+			zap.L().Warn("Failed to sample thumbnail candidate", zap.Float64("at", duration*at), zap.Error(err))
+			continue
+		}
+
+		if best != nil && !c.betterThan(best) {
+			os.Remove(c.path)
+			continue
+		}
+
+		if best != nil {
+			os.Remove(best.path)
+		}
+
+		best = c
+	}
+
+	if best == nil {
+		return captureFrame(ctx, input, 0, userID, j)
+	}
+
+	zap.L().Debug("Picked thumbnail",
+		zap.Float64("brightness", best.brightness),
+		zap.Float64("contrast", best.contrast),
+		zap.Float64("blur", best.blur))
+
+	return best.path, nil
+}
+
+// sampleFrame lets the thumbnail filter pick the most representative frame
+// of the next second or so after t and measures it
+func sampleFrame(ctx context.Context, input string, t float64, userID string, j *JobQueue) (*thumbnailCandidate, error) {
 	done := make(chan error, 1)
+	candidate := &thumbnailCandidate{
+		path: path.Join(os.TempDir(), util.RandStr(10)+".webp"),
+	}
+
+	var stats bytes.Buffer
+
+	err := j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Output: &stats,
+		Args: &[]string{
+			"-loglevel", "error",
+			"-ss", strconv.FormatFloat(t, 'f', 3, 64),
+			"-i", input,
+			"-filter_complex", "[0:v:0]thumbnail=n=30,scale=1280:-1,split[out][m];" +
+				"[m]scale=320:-2,format=yuv420p,signalstats,blurdetect,metadata=mode=print:file=-,nullsink",
+			"-map", "[out]",
+			"-frames:v", "1",
+			"-q:v", "1",
+			"-compression_level", "4",
+			candidate.path,
+		},
+		Done:       done,
+		Ctx:        ctx,
+		NoProgress: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			os.Remove(candidate.path)
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var low, high float64
+
+	scanner := bufio.NewScanner(&stats)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+
+		switch key {
+		case "lavfi.signalstats.YAVG":
+			candidate.brightness = v
+		case "lavfi.signalstats.YLOW":
+			low = v
+		case "lavfi.signalstats.YHIGH":
+			high = v
+		case "lavfi.blur":
+			candidate.blur = v
+		}
+	}
+
+	candidate.contrast = high - low
+
+	return candidate, nil
+}
+
+// CaptureFrame saves the frame at t seconds as a thumbnail
+func CaptureFrame(input string, t float64, userID string, j *JobQueue) (p string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
 
+	return captureFrame(ctx, input, t, userID, j)
+}
+
+// captureFrame writes the frame at t to a WebP image. Filters are applied
+// to the frame before it's scaled down
+func captureFrame(ctx context.Context, input string, t float64, userID string, j *JobQueue, filters ...string) (p string, err error) {
+	zap.L().Debug("Capturing frame for thumbnail", zap.Float64("at", t))
+
+	done := make(chan error, 1)
+
 	thumbPath := path.Join(os.TempDir(), util.RandStr(10)+".webp")
 	zap.L().Debug("Writing thumbnail file", zap.String("path", thumbPath))
 
@@ -28,16 +207,17 @@ func MakeThumbnail(input, userID string, j *JobQueue) (p string, err error) {
 		UserID: userID,
 		Args: &[]string{
 			"-loglevel", "error",
-			"-ss", "0",
+			"-ss", strconv.FormatFloat(t, 'f', 3, 64),
 			"-i", input,
 			"-frames:v", "1",
-			"-vf", "scale=1280:-1",
+			"-vf", strings.Join(append(filters, "scale=1280:-1"), ","),
 			"-q:v", "1",
 			"-compression_level", "4",
 			thumbPath,
 		},
-		Done: done,
-		Ctx:  ctx,
+		Done:       done,
+		Ctx:        ctx,
+		NoProgress: true,
 	})
 	if err != nil {
 		return "", err
@@ -54,3 +234,45 @@ func MakeThumbnail(input, userID string, j *JobQueue) (p string, err error) {
 
 	return thumbPath, nil
 }
+
+// MakeWaveform draws the waveform of an audio file to use as its thumbnail
+func MakeWaveform(input, userID string, j *JobQueue) (p string, err error) {
+	zap.L().Debug("Creating waveform for audio")
+
+	done := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	wavePath := path.Join(os.TempDir(), util.RandStr(10)+".webp")
+	zap.L().Debug("Writing waveform file", zap.String("path", wavePath))
+
+	err = j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Args: &[]string{
+			"-loglevel", "error",
+			"-i", input,
+			"-filter_complex", "aformat=channel_layouts=mono,showwavespic=s=1280x360:colors=0x6366f1",
+			"-frames:v", "1",
+			"-compression_level", "4",
+			wavePath,
+		},
+		Done:       done,
+		Ctx:        ctx,
+		NoProgress: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", err
+		}
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	return wavePath, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import "bitwise74/video-api/pkg/validators"
+
+// MapTime moves a timestamp of a source video of the provided duration to
+// where it ends up after processing. Returns false if that moment was cut
+// out. Loops keep the first play. Crossfades pull every following
+// segment back by their duration
+func MapTime(opts *validators.ProcessingOptions, duration, t float64) (float64, bool) {
+	start := max(opts.TrimStart, 0)
+	end := duration
+	if opts.TrimEnd > 0 {
+		end = min(opts.TrimEnd, duration)
+	}
+
+	if t < start || t >= end {
+		return 0, false
+	}
+
+	out := t - start
+	total := end - start
+
+	if len(opts.Segments) > 0 {
+		ranges := segmentsToKeep(opts, total)
+
+		found := false
+		kept := 0.0
+
+		for _, r := range ranges {
+			if !found && out >= r.Start && out < r.End {
+				out = kept + out - r.Start
+				found = true
+			}
+
+			kept += r.End - r.Start - opts.Crossfade
+		}
+
+		if !found {
+			return 0, false
+		}
+
+		total = kept + opts.Crossfade
+	}
+
+	if opts.Reverse {
+		out = total - out
+	}
+
+	if opts.Speed > 0 {
+		out /= opts.Speed
+	}
+
+	return out, true
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"math"
+	"testing"
+)
+
+func TestMapTime(t *testing.T) {
+	segments := validators.TimeRanges{{Start: 2, End: 4}, {Start: 6, End: 8}}
+
+	tests := []struct {
+		name   string
+		opts   validators.ProcessingOptions
+		t      float64
+		want   float64
+		wantOK bool
+	}{
+		{"untouched", validators.ProcessingOptions{}, 5, 5, true},
+		{"trimmed start", validators.ProcessingOptions{TrimStart: 2}, 5, 3, true},
+		{"before trim start", validators.ProcessingOptions{TrimStart: 2}, 1, 0, false},
+		{"at trim end", validators.ProcessingOptions{TrimEnd: 8}, 8, 0, false},
+		{"past the video", validators.ProcessingOptions{}, 10, 0, false},
+		{"trim end past the video", validators.ProcessingOptions{TrimEnd: 20}, 9, 9, true},
+		{"first kept segment", validators.ProcessingOptions{Segments: segments, SegmentMode: "keep"}, 3, 1, true},
+		{"second kept segment", validators.ProcessingOptions{Segments: segments, SegmentMode: "keep"}, 7, 3, true},
+		{"between kept segments", validators.ProcessingOptions{Segments: segments, SegmentMode: "keep"}, 5, 0, false},
+		{"removed segment", validators.ProcessingOptions{Segments: segments, SegmentMode: "remove"}, 3, 0, false},
+		{"after removed segment", validators.ProcessingOptions{Segments: segments, SegmentMode: "remove"}, 5, 3, true},
+		{"crossfade pulls back", validators.ProcessingOptions{Segments: segments, SegmentMode: "keep", Crossfade: 0.5}, 7, 2.5, true},
+		{"segments after trim", validators.ProcessingOptions{TrimStart: 1, Segments: segments, SegmentMode: "keep"}, 7, 3, true},
+		{"speed", validators.ProcessingOptions{Speed: 2}, 5, 2.5, true},
+		{"reverse", validators.ProcessingOptions{Reverse: true}, 2, 8, true},
+		{"reverse and speed", validators.ProcessingOptions{Reverse: true, Speed: 2}, 2, 4, true},
+		{"reverse after trim", validators.ProcessingOptions{TrimStart: 2, TrimEnd: 6, Reverse: true}, 3, 3, true},
+		{"loop keeps first play", validators.ProcessingOptions{Loop: 3}, 5, 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := MapTime(&tt.opts, 10, tt.t)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOK)
+			}
+
+			if ok && math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import "os"
+
+// TonemapFilters returns the filters that turn an HDR stream into SDR that
+// looks right on regular screens.
+//
+// With zscale (libzimg) the picture is converted to linear light, tone
+// mapped with hable and converted back to BT.709. Without it there's no way
+// to linearize PQ or HLG, so as a fallback only the BT.2020 color matrix is
+// converted to BT.709. That fixes the tint but highlights stay compressed
+// and the picture looks flatter than a real tone map
+func TonemapFilters(s *ProbeStream) []string {
+	if !s.IsHDR() {
+		return nil
+	}
+
+	if os.Getenv("FFMPEG_TONEMAPPER") == "zscale" {
+		return []string{
+			"zscale=t=linear:npl=100",
+			"format=gbrpf32le",
+			"zscale=p=bt709",
+			"tonemap=tonemap=hable:desat=0",
+			"zscale=t=bt709:m=bt709:r=tv",
+			"format=yuv420p",
+		}
+	}
+
+	return []string{
+		"scale=in_color_matrix=bt2020:out_color_matrix=bt709:out_range=tv",
+		"format=yuv420p",
+	}
+}
+
+// SDRColorFlags tags the output of a tone map as BT.709 so players don't
+// treat it as HDR
+func SDRColorFlags() []string {
+	return []string{
+		"-color_primaries", "bt709",
+		"-color_trc", "bt709",
+		"-colorspace", "bt709",
+	}
+}
+
+// HDRColorFlags keeps the color tags of an HDR stream when it's re-encoded
+// without tone mapping. The encoder picks a 10-bit format from the input
+func HDRColorFlags(s *ProbeStream) []string {
+	flags := []string{"-color_trc", s.ColorTransfer}
+
+	if s.ColorPrimaries != "" {
+		flags = append(flags, "-color_primaries", s.ColorPrimaries)
+	}
+
+	if s.ColorSpace != "" {
+		flags = append(flags, "-colorspace", s.ColorSpace)
+	}
+
+	return flags
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +19,16 @@ import (
 
 const minMultipartSize = 12 << 20
 
+// File extensions of the formats that can be stored
+var formatExtensions = map[string]string{
+	"video/mp4":  ".mp4",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"audio/mpeg": ".mp3",
+	"audio/ogg":  ".opus",
+	"audio/wav":  ".wav",
+}
+
 type Uploader struct {
 	S3       *a.S3Client
 	JobQueue *JobQueue
@@ -32,6 +43,18 @@ func NewUploader(j *JobQueue, s *a.S3Client) *Uploader {
 
 // Do should be used with a file that's ready for upload and was checked. It creates a thumbnail for the video file and uploads both files. Providing an override value will instead update an existing file. Files are deleted after upload
 func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File, error) {
+	return u.DoAs(p, name, userID, "video/mp4", override...)
+}
+
+// DoAs works like Do but stores the file with the provided content type.
+// GIFs get a thumbnail like videos do, audio gets its waveform and animated
+// WebP images already live at the thumbnail key so they're their own one
+func (u *Uploader) DoAs(p, name, userID, format string, override ...string) (*model.File, error) {
+	ext, ok := formatExtensions[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+
 	videoFile, err := os.Open(p)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open video file, %w", err)
@@ -41,17 +64,25 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 	videoStat, _ := videoFile.Stat()
 
-	thumbPath, err := MakeThumbnail(p, userID, u.JobQueue)
-	if err != nil {
-		return nil, fmt.Errorf("failed to upload to S3, %w", err)
-	}
+	var thumbFile *os.File
+	if ext != ".webp" {
+		makeThumbnail := MakeThumbnail
+		if strings.HasPrefix(format, "audio/") {
+			makeThumbnail = MakeWaveform
+		}
 
-	thumbFile, err := os.Open(thumbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open thumbnail file, %w", err)
+		thumbPath, err := makeThumbnail(p, userID, u.JobQueue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload to S3, %w", err)
+		}
+
+		thumbFile, err = os.Open(thumbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open thumbnail file, %w", err)
+		}
+		defer os.Remove(thumbPath)
+		defer thumbFile.Close()
 	}
-	defer os.Remove(thumbPath)
-	defer thumbFile.Close()
 
 	// Prepare things for background operations
 	var wg sync.WaitGroup
@@ -75,6 +106,12 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 	// Thumbnail upload
 	go func() {
 		defer wg.Done()
+
+		if thumbFile == nil {
+			errors <- nil
+			return
+		}
+
 		zap.L().Debug("Starting upload_thumbnail subprocess")
 
 		_, err := u.S3.C.PutObject(thumbnailCtx, &s3.PutObjectInput{
@@ -108,10 +145,10 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 		objectInput := &s3.PutObjectInput{
 			Bucket:        u.S3.Bucket,
-			Key:           aws.String(key + ".mp4"),
+			Key:           aws.String(key + ext),
 			Body:          videoFile,
 			ContentLength: aws.Int64(videoStat.Size()),
-			ContentType:   aws.String("video/mp4"),
+			ContentType:   aws.String(format),
 			CacheControl:  aws.String("public, max-age=3600, stale-while-revalidate=60"),
 		}
 
@@ -126,7 +163,7 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 			return
 		}
 
-		uploadedKeys = append(uploadedKeys, key+".mp4")
+		uploadedKeys = append(uploadedKeys, key+ext)
 		errors <- nil
 	}()
 
@@ -139,6 +176,14 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 		duration, err = GetDuration(p)
 		if err != nil {
+			// Older ffprobe builds can't read animated WebP images so
+			// their duration is left empty instead
+			if format == "image/webp" {
+				zap.L().Warn("Failed to get animation duration", zap.Error(err))
+				errors <- nil
+				return
+			}
+
 			errors <- fmt.Errorf("failed to get video duration: %w", err)
 			return
 		}
@@ -171,9 +216,9 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 	fileEnt := &model.File{
 		UserID:       userID,
-		FileKey:      key + ".mp4",
+		FileKey:      key + ext,
 		OriginalName: name,
-		Format:       "video/mp4",
+		Format:       format,
 		Size:         videoStat.Size(),
 		Tags:         []string{},
 		State:        "ready",
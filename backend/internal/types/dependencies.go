@@ -12,4 +12,5 @@ type Dependencies struct {
 	S3       *aws.S3Client
 	JobQueue *service.JobQueue
 	Uploader *service.Uploader
+	Assets   *service.AssetGenerator
 }
@@ -0,0 +1,8 @@
+package util
+
+import "os"
+
+// FileURL returns the CDN URL of a stored object
+func FileURL(key string) string {
+	return os.Getenv("CLOUDFRONT_URL") + "/" + key
+}
@@ -0,0 +1,83 @@
+package validators
+
+import (
+	"errors"
+	"math"
+)
+
+// Adjustments fix the colors and detail of every frame. Contrast, saturation
+// and gamma are left alone when they aren't set as 0 is a valid value for
+// some of them
+type Adjustments struct {
+	Brightness float64  `form:"brightness"` // Added to every pixel, 0 keeps it as is
+	Contrast   *float64 `form:"contrast"`   // 1 keeps it as is
+	Saturation *float64 `form:"saturation"` // 1 keeps it as is, 0 is grayscale
+	Gamma      *float64 `form:"gamma"`      // 1 keeps it as is
+	Denoise    float64  `form:"denoise"`    // Strength of the noise reduction
+	Sharpen    float64  `form:"sharpen"`    // Strength of the sharpening
+}
+
+const (
+	maxBrightness = 1
+	maxContrast   = 3
+	maxSaturation = 3
+	minGamma      = 0.1
+	maxGamma      = 3
+	maxDenoise    = 10
+	maxSharpen    = 3
+)
+
+var (
+	ErrAdjustmentNaN     = errors.New("adjustments must be finite numbers")
+	ErrBrightnessInvalid = errors.New("brightness must be between -1 and 1")
+	ErrContrastInvalid   = errors.New("contrast must be between 0 and 3")
+	ErrSaturationInvalid = errors.New("saturation must be between 0 and 3")
+	ErrGammaInvalid      = errors.New("gamma must be between 0.1 and 3")
+	ErrDenoiseInvalid    = errors.New("denoise strength must be between 0 and 10")
+	ErrSharpenInvalid    = errors.New("sharpen strength must be between 0 and 3")
+)
+
+// Validate makes sure every adjustment is within its range
+func (a *Adjustments) Validate() error {
+	// NaN fails every comparison so it would slip through the range checks
+	for _, v := range []*float64{&a.Brightness, a.Contrast, a.Saturation, a.Gamma, &a.Denoise, &a.Sharpen} {
+		if v != nil && (math.IsNaN(*v) || math.IsInf(*v, 0)) {
+			return ErrAdjustmentNaN
+		}
+	}
+
+	if a.Brightness < -maxBrightness || a.Brightness > maxBrightness {
+		return ErrBrightnessInvalid
+	}
+
+	if a.Contrast != nil && (*a.Contrast < 0 || *a.Contrast > maxContrast) {
+		return ErrContrastInvalid
+	}
+
+	if a.Saturation != nil && (*a.Saturation < 0 || *a.Saturation > maxSaturation) {
+		return ErrSaturationInvalid
+	}
+
+	if a.Gamma != nil && (*a.Gamma < minGamma || *a.Gamma > maxGamma) {
+		return ErrGammaInvalid
+	}
+
+	if a.Denoise < 0 || a.Denoise > maxDenoise {
+		return ErrDenoiseInvalid
+	}
+
+	if a.Sharpen < 0 || a.Sharpen > maxSharpen {
+		return ErrSharpenInvalid
+	}
+
+	return nil
+}
+
+// IsSet reports if any adjustment changes the picture
+func (a *Adjustments) IsSet() bool {
+	return a.Brightness != 0 ||
+		(a.Contrast != nil && *a.Contrast != 1) ||
+		(a.Saturation != nil && *a.Saturation != 1) ||
+		(a.Gamma != nil && *a.Gamma != 1) ||
+		a.Denoise > 0 || a.Sharpen > 0
+}
@@ -0,0 +1,31 @@
+package validators
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrChapterTitle = errors.New("chapter title must be between 1 and 100 characters without line breaks")
+	ErrChapterStart = errors.New("chapter start is outside of the video")
+)
+
+const maxChapterTitle = 100
+
+// ChapterValidator checks a chapter marker against the duration of its video
+func ChapterValidator(title string, start, duration float64) error {
+	title = strings.TrimSpace(title)
+
+	// Titles end up in WebVTT cues where these would break the file
+	if title == "" || len(title) > maxChapterTitle ||
+		strings.ContainsFunc(title, unicode.IsControl) || strings.Contains(title, "-->") {
+		return ErrChapterTitle
+	}
+
+	if start < 0 || (duration > 0 && start >= duration) {
+		return ErrChapterStart
+	}
+
+	return nil
+}
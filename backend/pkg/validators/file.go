@@ -19,6 +19,7 @@ import (
 var (
 	ErrFileTooLarge        = errors.New("file too large")
 	ErrFileNameTooLong     = errors.New("file name is too long")
+	ErrFileNameEmpty       = errors.New("file name is empty")
 	ErrFileTypeUnsupported = errors.New("unsupported file type")
 	ErrNoFile              = errors.New("no file provided")
 	ErrNoSpace             = errors.New("not enough space")
@@ -100,13 +101,30 @@ func FileValidator(fh *multipart.FileHeader, db *gorm.DB, userID string) (int, m
 		}
 	}
 
-	fh.Filename = sanitizeFileName(fh.Filename)
+	fh.Filename = SanitizeFileName(fh.Filename)
 	f.Seek(0, 0)
 
 	return 0, f, nil
 }
 
-func sanitizeFileName(n string) string {
+// FileNameValidator checks a file name picked by the user, like the name of
+// a rendered video, with the same rules as the names of uploaded files and
+// returns it sanitized
+func FileNameValidator(n string) (string, error) {
+	if strings.TrimSpace(n) == "" {
+		return "", ErrFileNameEmpty
+	}
+
+	if len(n) > maxFileNameSize {
+		return "", ErrFileNameTooLong
+	}
+
+	return SanitizeFileName(n), nil
+}
+
+// SanitizeFileName replaces the characters that aren't safe to use in a file
+// name and cuts it down to the max length
+func SanitizeFileName(n string) string {
 	n = filepath.Base(n)
 	n = strings.TrimSpace(n)
 
@@ -117,8 +135,9 @@ func sanitizeFileName(n string) string {
 		n = "file"
 	}
 
+	// Cutting can split a multi-byte letter in half
 	if len(n) > maxFileNameSize {
-		n = n[:maxFileNameSize]
+		n = strings.ToValidUTF8(n[:maxFileNameSize], "")
 	}
 
 	return n
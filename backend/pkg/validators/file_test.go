@@ -0,0 +1,51 @@
+package validators
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFileNameValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{"plain", "holiday.mp4", "holiday.mp4", nil},
+		{"spaces", "my holiday.mp4", "my_holiday.mp4", nil},
+		{"letters", "café.mp4", "café.mp4", nil},
+		{"path", "../../etc/passwd", "passwd", nil},
+		{"empty", "", "", ErrFileNameEmpty},
+		{"whitespace", "   ", "", ErrFileNameEmpty},
+		{"too long", strings.Repeat("a", maxFileNameSize+1), "", ErrFileNameTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileNameValidator(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileNameCutsLongNames(t *testing.T) {
+	// Every é takes two bytes so the limit falls in the middle of one
+	got := SanitizeFileName("concat_" + strings.Repeat("é", maxFileNameSize))
+
+	if len(got) > maxFileNameSize {
+		t.Errorf("got %d bytes, want at most %d", len(got), maxFileNameSize)
+	}
+
+	if !utf8.ValidString(got) {
+		t.Error("name was cut in the middle of a letter")
+	}
+}
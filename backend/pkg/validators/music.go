@@ -0,0 +1,139 @@
+package validators
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	ErrMusicTooBig      = errors.New("music file is too big")
+	ErrMusicUnsupported = errors.New("unsupported music format, use MP3, M4A, AAC, WAV, OGG, OPUS or FLAC")
+
+	allowedMusicExts = []string{".mp3", ".m4a", ".aac", ".wav", ".ogg", ".opus", ".flac"}
+	validMusicModes  = []string{"mix", "replace"}
+
+	// FFmpeg is told which demuxer to use instead of guessing it from the
+	// content, where a playlist renamed to .mp3 could make it open other
+	// files or URLs
+	musicDemuxers = map[string]string{
+		"audio/mpeg":      "mp3",
+		"audio/aac":       "aac",
+		"video/mp4":       "mov", // Also covers m4a
+		"audio/wav":       "wav",
+		"application/ogg": "ogg", // Also covers opus
+		"audio/flac":      "flac",
+	}
+)
+
+const (
+	maxMusicSize   = 20 << 20
+	maxMusicOffset = 600
+)
+
+// MusicFileValidator checks an audio file uploaded as background music and
+// returns the FFmpeg demuxer to read it with
+func MusicFileValidator(fh *multipart.FileHeader) (string, error) {
+	if fh == nil {
+		return "", ErrNoFile
+	}
+
+	if fh.Size == 0 {
+		return "", ErrEmptyFile
+	}
+
+	if fh.Size > maxMusicSize {
+		return "", ErrMusicTooBig
+	}
+
+	if !slices.Contains(allowedMusicExts, strings.ToLower(filepath.Ext(fh.Filename))) {
+		return "", ErrMusicUnsupported
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return MusicFormat(f)
+}
+
+// MusicFormat checks the magic bytes of an audio file and returns the FFmpeg
+// demuxer to read it with
+func MusicFormat(r io.Reader) (string, error) {
+	mime, err := mimetype.DetectReader(r)
+	if err != nil {
+		return "", err
+	}
+
+	for m := mime; m != nil; m = m.Parent() {
+		if demuxer, ok := musicDemuxers[m.String()]; ok {
+			return demuxer, nil
+		}
+	}
+
+	return "", ErrMusicUnsupported
+}
+
+// HasMusic reports if background music was provided
+func (o *ProcessingOptions) HasMusic() bool {
+	return o.MusicFile != nil || o.MusicID != 0
+}
+
+// musicValidator checks the background music options and fills in defaults
+func musicValidator(o *ProcessingOptions) (int, error) {
+	if !o.HasMusic() {
+		if o.MusicMode != "" || o.MusicVolume != 0 || o.OriginalVolume != 0 || o.MusicOffset != 0 || o.Ducking {
+			return http.StatusBadRequest, errors.New("music options need a music file")
+		}
+
+		return 0, nil
+	}
+
+	if o.MusicFile != nil && o.MusicID != 0 {
+		return http.StatusBadRequest, errors.New("provide either a music file or a library item, not both")
+	}
+
+	if o.MusicFile != nil {
+		format, err := MusicFileValidator(o.MusicFile)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		o.MusicFormat = format
+	}
+
+	if o.IsAnimated() {
+		return http.StatusBadRequest, errors.New("animated exports can't have music")
+	}
+
+	if o.MusicMode == "" {
+		o.MusicMode = "mix"
+	}
+
+	if !slices.Contains(validMusicModes, o.MusicMode) {
+		return http.StatusBadRequest, errors.New("music mode must be either mix or replace")
+	}
+
+	if o.MusicVolume < -maxAudioGain || o.MusicVolume > maxAudioGain ||
+		o.OriginalVolume < -maxAudioGain || o.OriginalVolume > maxAudioGain {
+		return http.StatusBadRequest, errors.New("music and original volume must be between -30 and 30 dB")
+	}
+
+	if o.MusicOffset < -maxMusicOffset || o.MusicOffset > maxMusicOffset {
+		return http.StatusBadRequest, errors.New("music offset must be between -600 and 600 seconds")
+	}
+
+	if o.MusicMode == "replace" && (o.Ducking || o.OriginalVolume != 0) {
+		return http.StatusBadRequest, errors.New("ducking and original volume only work when mixing")
+	}
+
+	return 0, nil
+}
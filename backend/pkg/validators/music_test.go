@@ -0,0 +1,36 @@
+package validators
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMusicFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr error
+	}{
+		{"mp3 with ID3", "ID3\x04\x00\x00\x00\x00\x00\x00", "mp3", nil},
+		{"wav", "RIFF\x24\x00\x00\x00WAVEfmt ", "wav", nil},
+		{"ogg", "OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00", "ogg", nil},
+		{"flac", "fLaC\x00\x00\x00\x22", "flac", nil},
+		{"playlist", "#EXTM3U\nhttp://example.com/a.mp3\n", "", ErrMusicUnsupported},
+		{"text", "hello world", "", ErrMusicUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MusicFormat(strings.NewReader(tt.content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,18 @@ package validators
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"mime/multipart"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
 )
 
 type ProcessingOptions struct {
-	File           *multipart.FileHeader `form:"file"`
+	File           *multipart.FileHeader `form:"file" json:"-"` // Files can only be uploaded as multipart
 	TrimStart      float64               `form:"trimStart"`
 	TrimEnd        float64               `form:"trimEnd"`
 	TargetSize     float64               `form:"targetSize"`
@@ -18,12 +24,158 @@ type ProcessingOptions struct {
 	CropW          int                   `form:"crop[w]"`
 	CropH          int                   `form:"crop[h]"`
 
+	// Audio
+	Mute           bool    `form:"mute"`
+	AudioGain      float64 `form:"audioGain"` // In dB
+	NormalizeAudio bool    `form:"normalizeAudio"`
+	AudioTrack     *int    `form:"audioTrack"`
+	MixAudioTracks bool    `form:"mixAudioTracks"`
+
+	// Background music. Either a file uploaded with the request or one of
+	// the user's audio files. A positive offset delays the music and a
+	// negative one skips its start. It's cut off where the video ends
+	MusicFile      *multipart.FileHeader `form:"musicFile" json:"-"`
+	MusicID        uint                  `form:"musicId"`
+	MusicMode      string                `form:"musicMode"`      // mix (default) or replace
+	MusicVolume    float64               `form:"musicVolume"`    // In dB
+	OriginalVolume float64               `form:"originalVolume"` // In dB, only used when mixing
+	MusicOffset    float64               `form:"musicOffset"`    // In seconds
+	Ducking        bool                  `form:"ducking"`        // Lowers the music while the original audio is loud
+	MusicPath      string                `form:"-" json:"-"`     // Set by the handler once the music is on disk
+	MusicFormat    string                `form:"-" json:"-"`     // Demuxer of the music, set once its content is checked
+	MusicHasAudio  bool                  `form:"-" json:"-"`     // Set by FetchOverlays once the music is probed
+
+	// Time
+	Speed    float64 `form:"speed"`
+	Reverse  bool    `form:"reverse"`
+	Loop     int     `form:"loop"`       // How many times the clip is played
+	LoopPath string  `form:"-" json:"-"` // Set by the handler once the clip is rendered
+
+	// Orientation. Crop coordinates always refer to the upright video
+	// and the rotation is applied after cropping
+	Rotate int  `form:"rotate"` // Clockwise, in degrees
+	FlipH  bool `form:"flipH"`
+	FlipV  bool `form:"flipV"`
+
+	// Changes the aspect ratio for vertical platforms. Crop mode moves a
+	// window over the frame, without keyframes it stays in the middle and a
+	// single keyframe fixes it in place. Blur mode fits the whole frame on
+	// top of a blurred copy of itself
+	Reframe          string           `form:"reframe"`     // 9:16, 1:1 or 4:5
+	ReframeMode      string           `form:"reframeMode"` // crop (default) or blur
+	ReframeKeyframes ReframeKeyframes `form:"reframeKeyframes"`
+
+	// Multi-range trim. Ranges use the timestamps of the source video
+	Segments    TimeRanges `form:"segments"`
+	SegmentMode string     `form:"segmentMode"` // keep (default) or remove
+
+	// Cuts out the parts where the audio stays quiet. Can't be combined with
+	// segments as it uses them under the hood
+	RemoveSilence      bool    `form:"removeSilence"`
+	SilenceThreshold   float64 `form:"silenceThreshold"`   // In dB, quieter audio counts as silence
+	SilenceMinDuration float64 `form:"silenceMinDuration"` // Shorter pauses are kept
+	SilencePadding     float64 `form:"silencePadding"`     // Seconds kept on both sides of a silence
+
+	// Fades from and to black and silence, in seconds. Crossfade blends
+	// joined segments into each other instead of cutting between them
+	FadeIn    float64 `form:"fadeIn"`
+	FadeOut   float64 `form:"fadeOut"`
+	Crossfade float64 `form:"crossfade"`
+
+	// Smooths out camera shake. Only available if ffmpeg has vidstab or deshake
+	Stabilize      bool   `form:"stabilize"`
+	TransformsPath string `form:"-" json:"-"` // Set by the handler once the motion is analyzed
+
+	// Color and detail fixes
+	Adjustments
+
+	// Stream copies the trimmed range instead of re-encoding it. The start
+	// is moved back to the closest keyframe
+	FastTrim bool `form:"fastTrim"`
+
+	// Subtitles to burn into the video. Either a stored track of the
+	// edited file or a file uploaded with the request
+	SubtitleTrack uint                  `form:"subtitleTrack"`
+	SubtitleFile  *multipart.FileHeader `form:"subtitleFile" json:"-"`
+	SubtitlePath  string                `form:"-" json:"-"` // Set by the handler once the subtitles are on disk
+
+	// Overlays the user's watermark image
+	Watermark         bool    `form:"watermark"`
+	WatermarkPosition string  `form:"watermarkPosition"` // top-left, top-right, bottom-left or bottom-right (default)
+	WatermarkMargin   int     `form:"watermarkMargin"`   // In pixels
+	WatermarkScale    float64 `form:"watermarkScale"`    // Width relative to the video width
+	WatermarkOpacity  float64 `form:"watermarkOpacity"`  // 0 is treated as unset and defaults to fully opaque
+	WatermarkPath     string  `form:"-" json:"-"`        // Set by the handler once the image is on disk
+
+	// Text overlay. The time range uses the timestamps of the source video
+	Text         string  `form:"text"`
+	TextFont     string  `form:"textFont"`     // sans (default), serif or mono
+	TextSize     int     `form:"textSize"`     // In pixels
+	TextPosition string  `form:"textPosition"` // One of the watermark positions or top, center, bottom (default)
+	TextStart    float64 `form:"textStart"`
+	TextEnd      float64 `form:"textEnd"` // 0 means until the end
+
+	// Boxes that blur or cover parts of the video
+	Redactions Redactions `form:"redactions"`
+
+	// Exports an animated image or only the audio instead of a video.
+	// Animations drop the audio and audio exports drop the video
+	ExportFormat string  `form:"exportFormat"` // mp4 (default), gif, webp, mp3, opus or wav
+	ExportWidth  int     `form:"exportWidth"`  // In pixels, the height keeps the aspect ratio
+	ExportFPS    float64 `form:"exportFps"`
+	ExportLoop   int     `form:"exportLoop"` // How many times the animation plays, 0 loops forever
+
 	// Private
 	ShouldCrop bool
 }
 
+const (
+	maxAudioGain = 30
+	minSpeed     = 0.25
+	maxSpeed     = 4
+	maxLoops     = 10
+	MaxSegments  = 50
+
+	minSilenceThreshold = -80
+	maxSilenceThreshold = -10
+	minSilenceDuration  = 0.3
+	maxSilenceDuration  = 30
+	maxSilencePadding   = 2
+
+	maxFadeDuration      = 10
+	MaxCrossfadeDuration = 5
+
+	maxWatermarkMargin = 500
+	maxWatermarkScale  = 0.5
+	maxTextLength      = 200
+	minTextSize        = 8
+	maxTextSize        = 200
+	maxRedactions      = 20
+
+	maxReframeKeyframes = 100
+
+	maxAnimationDuration = 30
+	minAnimationWidth    = 16
+	maxAnimationWidth    = 1280
+	maxAnimationFPS      = 30
+	maxAnimationLoops    = 100
+)
+
+var (
+	validRotations          = []int{0, 90, 180, 270}
+	validWatermarkPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right"}
+	validTextPositions      = append([]string{"top", "center", "bottom"}, validWatermarkPositions...)
+	validFonts              = []string{"sans", "serif", "mono"}
+	validExportFormats      = []string{"mp4", "gif", "webp", "mp3", "opus", "wav"}
+	validReframeRatios      = []string{"9:16", "1:1", "4:5"}
+)
+
 // ProcessingOptsValidator needs the file header to check if the target size is bigger than the actual video size
 func ProcessingOptsValidator(o *ProcessingOptions, fSize float64) (code int, err error) {
+	if err := finiteValidator(o); err != nil {
+		return http.StatusBadRequest, err
+	}
+
 	if o.TrimStart > o.TrimEnd {
 		return http.StatusBadRequest, errors.New("trim start can't be bigger than trim end")
 	}
@@ -36,6 +188,98 @@ func ProcessingOptsValidator(o *ProcessingOptions, fSize float64) (code int, err
 		return http.StatusBadRequest, errors.New("invalid target size provided")
 	}
 
+	if o.AudioGain < -maxAudioGain || o.AudioGain > maxAudioGain {
+		return http.StatusBadRequest, errors.New("audio gain must be between -30 and 30 dB")
+	}
+
+	if o.AudioTrack != nil && *o.AudioTrack < 0 {
+		return http.StatusBadRequest, errors.New("invalid audio track provided")
+	}
+
+	if o.AudioTrack != nil && o.MixAudioTracks {
+		return http.StatusBadRequest, errors.New("can't select an audio track and mix all of them at once")
+	}
+
+	if code, err := musicValidator(o); err != nil {
+		return code, err
+	}
+
+	if o.Speed != 0 && (o.Speed < minSpeed || o.Speed > maxSpeed) {
+		return http.StatusBadRequest, errors.New("speed must be between 0.25 and 4")
+	}
+
+	if o.Loop < 0 || o.Loop > maxLoops {
+		return http.StatusBadRequest, errors.New("loop count must be between 0 and 10")
+	}
+
+	if !slices.Contains(validRotations, o.Rotate) {
+		return http.StatusBadRequest, errors.New("rotation must be 0, 90, 180 or 270 degrees")
+	}
+
+	if code, err := reframeValidator(o); err != nil {
+		return code, err
+	}
+
+	if len(o.Segments) > MaxSegments {
+		return http.StatusBadRequest, errors.New("too many segments provided")
+	}
+
+	if err := o.Segments.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	switch o.SegmentMode {
+	case "":
+		o.SegmentMode = "keep"
+	case "keep", "remove":
+	default:
+		return http.StatusBadRequest, errors.New("segment mode must be either keep or remove")
+	}
+
+	if code, err := silenceValidator(o); err != nil {
+		return code, err
+	}
+
+	if code, err := fadeValidator(o); err != nil {
+		return code, err
+	}
+
+	if err := o.Adjustments.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if o.Stabilize && os.Getenv("FFMPEG_STABILIZER") == "" {
+		return http.StatusBadRequest, errors.New("stabilization isn't available on this server")
+	}
+
+	if o.SubtitleFile != nil {
+		// The subtitles filter probes the format itself, the content check
+		// makes sure it can only find a subtitle format
+		if _, err := SubtitleFileValidator(o.SubtitleFile); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	if len(o.Redactions) > maxRedactions {
+		return http.StatusBadRequest, errors.New("too many redactions provided")
+	}
+
+	if err := o.Redactions.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if code, err := overlayValidator(o); err != nil {
+		return code, err
+	}
+
+	if code, err := exportValidator(o); err != nil {
+		return code, err
+	}
+
+	if o.FastTrim && o.requiresEncoding() {
+		return http.StatusBadRequest, errors.New("fast trim can't be combined with other edits")
+	}
+
 	// Cropping is disabled
 	if o.CropH <= 0 && o.CropW <= 0 && o.CropX <= 0 && o.CropY <= 0 {
 		o.ShouldCrop = false
@@ -46,3 +290,332 @@ func ProcessingOptsValidator(o *ProcessingOptions, fSize float64) (code int, err
 
 	return 0, nil
 }
+
+// requiresEncoding reports if any option other than trimming was set
+func (o *ProcessingOptions) requiresEncoding() bool {
+	return o.TargetSize > 0 || o.LosslessExport ||
+		o.FadeIn > 0 || o.FadeOut > 0 ||
+		o.Mute || o.AudioGain != 0 || o.NormalizeAudio || o.AudioTrack != nil || o.MixAudioTracks || o.HasMusic() ||
+		o.requiresVideo() ||
+		(o.ExportFormat != "" && o.ExportFormat != "mp4")
+}
+
+// requiresVideo reports if any option that works on the picture was set
+func (o *ProcessingOptions) requiresVideo() bool {
+	return o.CropX > 0 || o.CropY > 0 || o.CropW > 0 || o.CropH > 0 ||
+		(o.Speed != 0 && o.Speed != 1) || o.Reverse || o.Loop > 1 ||
+		o.Rotate != 0 || o.FlipH || o.FlipV || o.Stabilize || o.Adjustments.IsSet() || o.Reframe != "" ||
+		len(o.Segments) > 0 || o.RemoveSilence ||
+		o.SubtitleTrack != 0 || o.SubtitleFile != nil ||
+		o.Watermark || o.Text != "" ||
+		len(o.Redactions) > 0
+}
+
+// finiteValidator rejects NaN and infinite numbers. NaN fails every
+// comparison so it would slip through the range checks
+func finiteValidator(o *ProcessingOptions) error {
+	fields := []struct {
+		name  string
+		value float64
+	}{
+		{"trimStart", o.TrimStart},
+		{"trimEnd", o.TrimEnd},
+		{"targetSize", o.TargetSize},
+		{"audioGain", o.AudioGain},
+		{"musicVolume", o.MusicVolume},
+		{"originalVolume", o.OriginalVolume},
+		{"musicOffset", o.MusicOffset},
+		{"speed", o.Speed},
+		{"silenceThreshold", o.SilenceThreshold},
+		{"silenceMinDuration", o.SilenceMinDuration},
+		{"silencePadding", o.SilencePadding},
+		{"fadeIn", o.FadeIn},
+		{"fadeOut", o.FadeOut},
+		{"crossfade", o.Crossfade},
+		{"watermarkScale", o.WatermarkScale},
+		{"watermarkOpacity", o.WatermarkOpacity},
+		{"textStart", o.TextStart},
+		{"textEnd", o.TextEnd},
+		{"exportFps", o.ExportFPS},
+	}
+
+	for _, f := range fields {
+		if math.IsNaN(f.value) || math.IsInf(f.value, 0) {
+			return fmt.Errorf("%s must be a finite number", f.name)
+		}
+	}
+
+	return nil
+}
+
+// reframeValidator checks the reframe options and fills in defaults
+func reframeValidator(o *ProcessingOptions) (int, error) {
+	if o.Reframe == "" {
+		if o.ReframeMode != "" || len(o.ReframeKeyframes) > 0 {
+			return http.StatusBadRequest, errors.New("reframe options need an aspect ratio")
+		}
+
+		return 0, nil
+	}
+
+	if !slices.Contains(validReframeRatios, o.Reframe) {
+		return http.StatusBadRequest, errors.New("reframe aspect ratio must be 9:16, 1:1 or 4:5")
+	}
+
+	switch o.ReframeMode {
+	case "":
+		o.ReframeMode = "crop"
+	case "crop", "blur":
+	default:
+		return http.StatusBadRequest, errors.New("reframe mode must be either crop or blur")
+	}
+
+	if o.ReframeMode == "blur" && len(o.ReframeKeyframes) > 0 {
+		return http.StatusBadRequest, errors.New("keyframes only work with the crop reframe mode")
+	}
+
+	if len(o.ReframeKeyframes) > maxReframeKeyframes {
+		return http.StatusBadRequest, errors.New("too many reframe keyframes provided")
+	}
+
+	if err := o.ReframeKeyframes.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return 0, nil
+}
+
+// silenceValidator checks the silence removal options and fills in defaults
+func silenceValidator(o *ProcessingOptions) (int, error) {
+	if !o.RemoveSilence {
+		return 0, nil
+	}
+
+	if len(o.Segments) > 0 {
+		return http.StatusBadRequest, errors.New("silence removal can't be combined with segments")
+	}
+
+	if o.SilenceThreshold == 0 {
+		o.SilenceThreshold = -35
+	}
+
+	if o.SilenceThreshold < minSilenceThreshold || o.SilenceThreshold > maxSilenceThreshold {
+		return http.StatusBadRequest, errors.New("silence threshold must be between -80 and -10 dB")
+	}
+
+	if o.SilenceMinDuration == 0 {
+		o.SilenceMinDuration = 1
+	}
+
+	if o.SilenceMinDuration < minSilenceDuration || o.SilenceMinDuration > maxSilenceDuration {
+		return http.StatusBadRequest, errors.New("minimum silence duration must be between 0.3 and 30 seconds")
+	}
+
+	if o.SilencePadding == 0 {
+		o.SilencePadding = 0.2
+	}
+
+	if o.SilencePadding < 0 || o.SilencePadding > maxSilencePadding {
+		return http.StatusBadRequest, errors.New("silence padding must be between 0 and 2 seconds")
+	}
+
+	return 0, nil
+}
+
+// fadeValidator checks the fade and crossfade options. The fades are checked
+// against the length of the output once it's known for sure
+func fadeValidator(o *ProcessingOptions) (int, error) {
+	if o.FadeIn < 0 || o.FadeIn > maxFadeDuration || o.FadeOut < 0 || o.FadeOut > maxFadeDuration {
+		return http.StatusBadRequest, errors.New("fades must be between 0 and 10 seconds")
+	}
+
+	if o.Crossfade < 0 || o.Crossfade > MaxCrossfadeDuration {
+		return http.StatusBadRequest, errors.New("crossfade must be between 0 and 5 seconds")
+	}
+
+	if o.Crossfade > 0 && len(o.Segments) == 0 && !o.RemoveSilence {
+		return http.StatusBadRequest, errors.New("crossfade needs segments to join")
+	}
+
+	// Catches the obvious cases early, segments can only make the clip shorter
+	length := o.TrimEnd - o.TrimStart
+	if o.Loop > 1 {
+		length *= float64(o.Loop)
+	}
+
+	if o.Speed > 0 {
+		length /= o.Speed
+	}
+
+	if o.TrimEnd > 0 && o.FadeIn+o.FadeOut > length {
+		return http.StatusBadRequest, errors.New("fades can't be longer than the clip")
+	}
+
+	return 0, nil
+}
+
+// IsAnimated reports if the output is an animated image instead of a video
+func (o *ProcessingOptions) IsAnimated() bool {
+	return o.ExportFormat == "gif" || o.ExportFormat == "webp"
+}
+
+// IsAudioOnly reports if only the audio is exported
+func (o *ProcessingOptions) IsAudioOnly() bool {
+	return o.ExportFormat == "mp3" || o.ExportFormat == "opus" || o.ExportFormat == "wav"
+}
+
+// ChangesTiming reports if moments of the source end up at another time in
+// the output. Loops don't count as only the first play is considered
+func (o *ProcessingOptions) ChangesTiming() bool {
+	return o.TrimStart > 0 || o.TrimEnd > 0 || len(o.Segments) > 0 ||
+		(o.Speed != 0 && o.Speed != 1) || o.Reverse
+}
+
+// MimeType returns the content type of the output
+func (o *ProcessingOptions) MimeType() string {
+	switch o.ExportFormat {
+	case "gif":
+		return "image/gif"
+	case "webp":
+		return "image/webp"
+	case "mp3":
+		return "audio/mpeg"
+	case "opus":
+		return "audio/ogg"
+	case "wav":
+		return "audio/wav"
+	default:
+		return "video/mp4"
+	}
+}
+
+// exportValidator checks the animated and audio export options and fills
+// in defaults
+func exportValidator(o *ProcessingOptions) (int, error) {
+	if o.ExportFormat == "" {
+		o.ExportFormat = "mp4"
+	}
+
+	if !slices.Contains(validExportFormats, o.ExportFormat) {
+		return http.StatusBadRequest, errors.New("export format must be mp4, gif, webp, mp3, opus or wav")
+	}
+
+	if o.IsAudioOnly() {
+		if o.FastTrim || o.LosslessExport || o.TargetSize > 0 || o.Mute || o.requiresVideo() {
+			return http.StatusBadRequest, errors.New("audio exports only support trimming and audio options")
+		}
+
+		return 0, nil
+	}
+
+	if !o.IsAnimated() {
+		return 0, nil
+	}
+
+	if o.FastTrim || o.LosslessExport || o.TargetSize > 0 {
+		return http.StatusBadRequest, errors.New("animated exports can't be fast trimmed, lossless or sized")
+	}
+
+	// Every frame of an animation is stored in full so they get big fast
+	if o.TrimEnd-o.TrimStart > maxAnimationDuration {
+		return http.StatusBadRequest, errors.New("animated exports can be at most 30 seconds long")
+	}
+
+	if o.ExportWidth == 0 {
+		o.ExportWidth = 480
+	}
+
+	if o.ExportWidth < minAnimationWidth || o.ExportWidth > maxAnimationWidth {
+		return http.StatusBadRequest, errors.New("export width must be between 16 and 1280 pixels")
+	}
+
+	if o.ExportFPS == 0 {
+		o.ExportFPS = 15
+	}
+
+	if o.ExportFPS < 1 || o.ExportFPS > maxAnimationFPS {
+		return http.StatusBadRequest, errors.New("export frame rate must be between 1 and 30")
+	}
+
+	if o.ExportLoop < 0 || o.ExportLoop > maxAnimationLoops {
+		return http.StatusBadRequest, errors.New("export loop count must be between 0 and 100")
+	}
+
+	return 0, nil
+}
+
+// overlayValidator checks the watermark and text options and fills in defaults
+func overlayValidator(o *ProcessingOptions) (int, error) {
+	if o.Watermark {
+		if o.WatermarkPosition == "" {
+			o.WatermarkPosition = "bottom-right"
+		}
+
+		if !slices.Contains(validWatermarkPositions, o.WatermarkPosition) {
+			return http.StatusBadRequest, errors.New("invalid watermark position provided")
+		}
+
+		if o.WatermarkMargin < 0 || o.WatermarkMargin > maxWatermarkMargin {
+			return http.StatusBadRequest, errors.New("watermark margin must be between 0 and 500 pixels")
+		}
+
+		if o.WatermarkScale == 0 {
+			o.WatermarkScale = 0.15
+		}
+
+		if o.WatermarkScale < 0 || o.WatermarkScale > maxWatermarkScale {
+			return http.StatusBadRequest, errors.New("watermark scale must be between 0 and 0.5")
+		}
+
+		// A fully transparent watermark would be pointless so 0 means unset
+		if o.WatermarkOpacity == 0 {
+			o.WatermarkOpacity = 1
+		}
+
+		if o.WatermarkOpacity < 0 || o.WatermarkOpacity > 1 {
+			return http.StatusBadRequest, errors.New("watermark opacity must be between 0 and 1")
+		}
+	}
+
+	if o.Text == "" {
+		return 0, nil
+	}
+
+	if len(o.Text) > maxTextLength {
+		return http.StatusBadRequest, errors.New("text is too long")
+	}
+
+	if strings.ContainsFunc(o.Text, unicode.IsControl) {
+		return http.StatusBadRequest, errors.New("text can't contain control characters")
+	}
+
+	if o.TextFont == "" {
+		o.TextFont = "sans"
+	}
+
+	if !slices.Contains(validFonts, o.TextFont) {
+		return http.StatusBadRequest, errors.New("invalid font provided")
+	}
+
+	if o.TextSize == 0 {
+		o.TextSize = 48
+	}
+
+	if o.TextSize < minTextSize || o.TextSize > maxTextSize {
+		return http.StatusBadRequest, errors.New("text size must be between 8 and 200 pixels")
+	}
+
+	if o.TextPosition == "" {
+		o.TextPosition = "bottom"
+	}
+
+	if !slices.Contains(validTextPositions, o.TextPosition) {
+		return http.StatusBadRequest, errors.New("invalid text position provided")
+	}
+
+	if o.TextStart < 0 || (o.TextEnd != 0 && o.TextEnd <= o.TextStart) {
+		return http.StatusBadRequest, errors.New("invalid text time range provided")
+	}
+
+	return 0, nil
+}
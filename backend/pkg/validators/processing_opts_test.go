@@ -0,0 +1,75 @@
+package validators
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProcessingOptsValidator(t *testing.T) {
+	nan := math.NaN()
+	inf := math.Inf(1)
+
+	tests := []struct {
+		name string
+		opts ProcessingOptions
+		want string // Part of the error, empty if the options are valid
+	}{
+		{"trim only", ProcessingOptions{TrimEnd: 10}, ""},
+		{"speed and loop", ProcessingOptions{TrimEnd: 10, Speed: 2, Loop: 3}, ""},
+		{"NaN trim start", ProcessingOptions{TrimStart: nan, TrimEnd: 10}, "trimStart must be a finite number"},
+		{"infinite trim end", ProcessingOptions{TrimEnd: inf}, "trimEnd must be a finite number"},
+		{"negative infinite audio gain", ProcessingOptions{TrimEnd: 10, AudioGain: math.Inf(-1)}, "audioGain must be a finite number"},
+		{"NaN speed", ProcessingOptions{TrimEnd: 10, Speed: nan}, "speed must be a finite number"},
+		{"NaN fade in", ProcessingOptions{TrimEnd: 10, FadeIn: nan}, "fadeIn must be a finite number"},
+		{"NaN silence threshold", ProcessingOptions{TrimEnd: 10, SilenceThreshold: nan}, "silenceThreshold must be a finite number"},
+		{"NaN watermark opacity", ProcessingOptions{TrimEnd: 10, WatermarkOpacity: nan}, "watermarkOpacity must be a finite number"},
+		{"NaN export frame rate", ProcessingOptions{TrimEnd: 10, ExportFPS: nan}, "exportFps must be a finite number"},
+		{"trim start after trim end", ProcessingOptions{TrimStart: 5, TrimEnd: 4}, "trim start can't be bigger"},
+		{"trim start equals trim end", ProcessingOptions{TrimStart: 5, TrimEnd: 5}, "can't be the same"},
+		{"speed too low", ProcessingOptions{TrimEnd: 10, Speed: 0.1}, "speed must be between"},
+		{"speed too high", ProcessingOptions{TrimEnd: 10, Speed: 5}, "speed must be between"},
+		{"too many loops", ProcessingOptions{TrimEnd: 10, Loop: 11}, "loop count"},
+		{"negative loop", ProcessingOptions{TrimEnd: 10, Loop: -1}, "loop count"},
+		{"audio gain too high", ProcessingOptions{TrimEnd: 10, AudioGain: 31}, "audio gain must be between"},
+		{"odd rotation", ProcessingOptions{TrimEnd: 10, Rotate: 45}, "rotation must be"},
+		{"fades longer than clip", ProcessingOptions{TrimEnd: 10, FadeIn: 6, FadeOut: 6}, "fades can't be longer"},
+		{"crossfade without segments", ProcessingOptions{TrimEnd: 10, Crossfade: 1}, "crossfade needs segments"},
+		{"music volume without music", ProcessingOptions{TrimEnd: 10, MusicVolume: 3}, "music options need a music file"},
+		{"unknown segment mode", ProcessingOptions{TrimEnd: 10, Segments: TimeRanges{{Start: 1, End: 2}}, SegmentMode: "split"}, "segment mode"},
+		{"fast trim with other edits", ProcessingOptions{TrimEnd: 10, FastTrim: true, Reverse: true}, "fast trim can't be combined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := ProcessingOptsValidator(&tt.opts, 1<<30)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+
+			if code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestProcessingOptsValidatorCrop(t *testing.T) {
+	o := ProcessingOptions{TrimEnd: 10, CropW: 100, CropH: 100}
+	if _, err := ProcessingOptsValidator(&o, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+
+	if !o.ShouldCrop {
+		t.Error("crop wasn't enabled")
+	}
+}
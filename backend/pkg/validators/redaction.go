@@ -0,0 +1,65 @@
+package validators
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+var (
+	ErrRedactionInvalid = errors.New("invalid redaction box provided")
+	ErrRedactionMode    = errors.New("redaction mode must be blur, pixelate or solid")
+
+	validRedactionModes = []string{"blur", "pixelate", "solid"}
+)
+
+// Redaction hides a rectangle of the video for a period of time. The box
+// uses the coordinates of the upright source video, same as cropping, and
+// the time range its timestamps
+type Redaction struct {
+	X     int     `json:"x"`
+	Y     int     `json:"y"`
+	W     int     `json:"w"`
+	H     int     `json:"h"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`  // 0 means until the end
+	Mode  string  `json:"mode"` // blur (default), pixelate or solid
+}
+
+type Redactions []Redaction
+
+// UnmarshalParam allows redactions to be sent as a JSON string inside of
+// multipart forms
+func (r *Redactions) UnmarshalParam(param string) error {
+	if param == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(param), r)
+}
+
+// Validate checks every box and fills in the default mode. Frame bounds
+// are checked once the video is probed
+func (r Redactions) Validate() error {
+	for i := range r {
+		b := &r[i]
+
+		if b.X < 0 || b.Y < 0 || b.W <= 0 || b.H <= 0 {
+			return ErrRedactionInvalid
+		}
+
+		if b.Start < 0 || (b.End != 0 && b.End <= b.Start) {
+			return ErrRedactionInvalid
+		}
+
+		if b.Mode == "" {
+			b.Mode = "blur"
+		}
+
+		if !slices.Contains(validRedactionModes, b.Mode) {
+			return ErrRedactionMode
+		}
+	}
+
+	return nil
+}
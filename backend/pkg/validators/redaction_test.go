@@ -0,0 +1,52 @@
+package validators
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRedactionsUnmarshalParam(t *testing.T) {
+	var r Redactions
+	if err := r.UnmarshalParam(`[{"x":1,"y":2,"w":30,"h":40,"start":1,"end":2,"mode":"solid"}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Redaction{X: 1, Y: 2, W: 30, H: 40, Start: 1, End: 2, Mode: "solid"}
+	if len(r) != 1 || r[0] != want {
+		t.Errorf("got %v, want %v", r, want)
+	}
+
+	if err := r.UnmarshalParam("not json"); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestRedactionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		box  Redaction
+		want error
+	}{
+		{"defaults to blur", Redaction{W: 10, H: 10}, nil},
+		{"until the end", Redaction{W: 10, H: 10, Start: 5}, nil},
+		{"negative position", Redaction{X: -1, W: 10, H: 10}, ErrRedactionInvalid},
+		{"no width", Redaction{H: 10}, ErrRedactionInvalid},
+		{"negative start", Redaction{W: 10, H: 10, Start: -1}, ErrRedactionInvalid},
+		{"end before start", Redaction{W: 10, H: 10, Start: 5, End: 4}, ErrRedactionInvalid},
+		{"unknown mode", Redaction{W: 10, H: 10, Mode: "erase"}, ErrRedactionMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Redactions{tt.box}
+
+			if err := r.Validate(); !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+
+			if tt.want == nil && r[0].Mode == "" {
+				t.Error("mode wasn't filled in")
+			}
+		})
+	}
+}
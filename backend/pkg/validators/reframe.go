@@ -0,0 +1,45 @@
+package validators
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrReframeKeyframeInvalid = errors.New("invalid reframe keyframe provided")
+
+// ReframeKeyframe places the center of the reframe window at a point in
+// time. X and Y are relative to the width and height of the frame, so 0.5
+// is the middle, and the time uses the timestamps of the source video
+type ReframeKeyframe struct {
+	Time float64 `json:"time"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+}
+
+type ReframeKeyframes []ReframeKeyframe
+
+// UnmarshalParam allows keyframes to be sent as a JSON string inside of
+// multipart forms
+func (k *ReframeKeyframes) UnmarshalParam(param string) error {
+	if param == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(param), k)
+}
+
+// Validate checks that every keyframe is inside of the frame and that they
+// are sorted by time
+func (k ReframeKeyframes) Validate() error {
+	for i, f := range k {
+		if f.Time < 0 || f.X < 0 || f.X > 1 || f.Y < 0 || f.Y > 1 {
+			return ErrReframeKeyframeInvalid
+		}
+
+		if i > 0 && f.Time <= k[i-1].Time {
+			return errors.New("reframe keyframes must be sorted by time")
+		}
+	}
+
+	return nil
+}
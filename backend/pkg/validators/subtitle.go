@@ -0,0 +1,127 @@
+package validators
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrSubtitleTooBig      = errors.New("subtitle file is too big")
+	ErrSubtitleUnsupported = errors.New("unsupported subtitle format, use SRT, ASS or VTT")
+	ErrSubtitleLanguage    = errors.New("invalid subtitle language, use a code like en or pt-BR")
+	ErrSubtitleLabel       = errors.New("subtitle label is too long")
+
+	languageRe = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+	srtIndexRe = regexp.MustCompile(`^[0-9]+$`)
+
+	// FFmpeg demuxer of every supported extension. It's forced when reading
+	// the file so ffmpeg never guesses the format from the content
+	subtitleDemuxers = map[string]string{
+		".srt": "srt",
+		".ass": "ass",
+		".ssa": "ass",
+		".vtt": "webvtt",
+	}
+)
+
+const (
+	maxSubtitleSize  = 2 << 20
+	maxSubtitleLabel = 64
+)
+
+// SubtitleValidator checks an uploaded subtitle track and its labels and
+// returns the FFmpeg demuxer to read it with
+func SubtitleValidator(fh *multipart.FileHeader, language, label string) (string, error) {
+	format, err := SubtitleFileValidator(fh)
+	if err != nil {
+		return "", err
+	}
+
+	if !languageRe.MatchString(language) {
+		return "", ErrSubtitleLanguage
+	}
+
+	if len(label) > maxSubtitleLabel {
+		return "", ErrSubtitleLabel
+	}
+
+	return format, nil
+}
+
+// SubtitleFileValidator only checks the subtitle file itself and returns the
+// FFmpeg demuxer to read it with. The content has to match the extension
+func SubtitleFileValidator(fh *multipart.FileHeader) (string, error) {
+	if fh == nil {
+		return "", ErrNoFile
+	}
+
+	if fh.Size == 0 {
+		return "", ErrEmptyFile
+	}
+
+	if fh.Size > maxSubtitleSize {
+		return "", ErrSubtitleTooBig
+	}
+
+	format, ok := subtitleDemuxers[strings.ToLower(filepath.Ext(fh.Filename))]
+	if !ok {
+		return "", ErrSubtitleUnsupported
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	if subtitleFormat(head[:n]) != format {
+		return "", ErrSubtitleUnsupported
+	}
+
+	return format, nil
+}
+
+// subtitleFormat guesses the format of a subtitle file from its start.
+// Returns an empty string if it isn't a subtitle file
+func subtitleFormat(head []byte) string {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+
+	// Text files never have null bytes. Other encodings than UTF-8 are
+	// allowed as a lot of older SRT files use them
+	if len(head) == 0 || bytes.IndexByte(head, 0) >= 0 {
+		return ""
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("WEBVTT")):
+		return "webvtt"
+	case bytes.HasPrefix(bytes.ToLower(head), []byte("[script info]")):
+		return "ass"
+	}
+
+	// SRT starts with the index of the first cue followed by its timing
+	scanner := bufio.NewScanner(bytes.NewReader(head))
+
+	if !scanner.Scan() || !srtIndexRe.MatchString(strings.TrimSpace(scanner.Text())) {
+		return ""
+	}
+
+	if !scanner.Scan() || !strings.Contains(scanner.Text(), "-->") {
+		return ""
+	}
+
+	return "srt"
+}
@@ -0,0 +1,30 @@
+package validators
+
+import "testing"
+
+func TestSubtitleFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"srt", "1\n00:00:01,000 --> 00:00:02,000\nHello\n", "srt"},
+		{"srt with CRLF and BOM", "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n", "srt"},
+		{"latin-1 srt", "1\n00:00:01,000 --> 00:00:02,000\nOl\xe1\n", "srt"},
+		{"webvtt", "WEBVTT\n\n00:01.000 --> 00:02.000\nHello\n", "webvtt"},
+		{"ass", "[Script Info]\nTitle: Test\n", "ass"},
+		{"leading blank lines", "\n\n1\n00:00:01,000 --> 00:00:02,000\n", "srt"},
+		{"empty", "", ""},
+		{"binary", "1\n00:00:01,000 --> \x00\x00", ""},
+		{"playlist", "#EXTM3U\nhttp://example.com/a.mp3\n", ""},
+		{"index without timing", "1\nHello\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subtitleFormat([]byte(tt.head)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
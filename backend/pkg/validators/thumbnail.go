@@ -0,0 +1,48 @@
+package validators
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"slices"
+)
+
+var (
+	ErrThumbnailTooBig      = errors.New("thumbnail image is too big")
+	ErrThumbnailUnsupported = errors.New("thumbnail has to be a PNG, JPEG or WebP image")
+
+	allowedThumbnailTypes = []string{"image/png", "image/jpeg", "image/webp"}
+)
+
+const maxThumbnailSize = 5 << 20
+
+// ThumbnailImageValidator checks an uploaded custom thumbnail
+func ThumbnailImageValidator(fh *multipart.FileHeader) error {
+	if fh.Size == 0 {
+		return ErrEmptyFile
+	}
+
+	if fh.Size > maxThumbnailSize {
+		return ErrThumbnailTooBig
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Check the magic bytes instead of trusting the header
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	if !slices.Contains(allowedThumbnailTypes, http.DetectContentType(head[:n])) {
+		return ErrThumbnailUnsupported
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package validators
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+var ErrTimeRangeInvalid = errors.New("invalid time range provided")
+
+// TimeRange is a section of a video in seconds
+type TimeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type TimeRanges []TimeRange
+
+// UnmarshalParam allows ranges to be sent as a JSON string inside of
+// multipart forms
+func (t *TimeRanges) UnmarshalParam(param string) error {
+	if param == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(param), t)
+}
+
+// Validate checks every range and sorts them, merging any that overlap
+func (t *TimeRanges) Validate() error {
+	for _, r := range *t {
+		if r.Start < 0 || r.End <= r.Start {
+			return ErrTimeRangeInvalid
+		}
+	}
+
+	slices.SortFunc(*t, func(a, b TimeRange) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+
+	merged := TimeRanges{}
+	for _, r := range *t {
+		if last := len(merged) - 1; last >= 0 && r.Start <= merged[last].End {
+			merged[last].End = max(merged[last].End, r.End)
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	*t = merged
+	return nil
+}
+
+// Clamp cuts the ranges down to the ones inside of start and end. Ranges
+// must be validated first
+func (t TimeRanges) Clamp(start, end float64) TimeRanges {
+	out := TimeRanges{}
+
+	for _, r := range t {
+		r.Start, r.End = max(r.Start, start), min(r.End, end)
+		if r.End > r.Start {
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// Invert returns the gaps between the ranges inside of start and end. Ranges
+// must be validated first
+func (t TimeRanges) Invert(start, end float64) TimeRanges {
+	out := TimeRanges{}
+
+	for _, r := range t.Clamp(start, end) {
+		if r.Start > start {
+			out = append(out, TimeRange{Start: start, End: r.Start})
+		}
+
+		start = r.End
+	}
+
+	if end > start {
+		out = append(out, TimeRange{Start: start, End: end})
+	}
+
+	return out
+}
+
+// Shift moves every range by the provided offset
+func (t TimeRanges) Shift(offset float64) TimeRanges {
+	out := make(TimeRanges, len(t))
+
+	for i, r := range t {
+		out[i] = TimeRange{Start: r.Start + offset, End: r.End + offset}
+	}
+
+	return out
+}
+
+// Duration returns the combined length of all ranges
+func (t TimeRanges) Duration() (d float64) {
+	for _, r := range t {
+		d += r.End - r.Start
+	}
+
+	return d
+}
@@ -0,0 +1,87 @@
+package validators
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTimeRangesUnmarshalParam(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   string
+		want    TimeRanges
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"one range", `[{"start":1,"end":2.5}]`, TimeRanges{{Start: 1, End: 2.5}}, false},
+		{"two ranges", `[{"start":1,"end":2},{"start":4,"end":5}]`, TimeRanges{{Start: 1, End: 2}, {Start: 4, End: 5}}, false},
+		{"not JSON", "1-2", nil, true},
+		{"not a list", `{"start":1,"end":2}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got TimeRanges
+			err := got.UnmarshalParam(tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeRangesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  TimeRanges
+		want    TimeRanges
+		wantErr bool
+	}{
+		{"sorted", TimeRanges{{Start: 4, End: 5}, {Start: 1, End: 2}}, TimeRanges{{Start: 1, End: 2}, {Start: 4, End: 5}}, false},
+		{"overlapping are merged", TimeRanges{{Start: 1, End: 3}, {Start: 2, End: 5}}, TimeRanges{{Start: 1, End: 5}}, false},
+		{"touching are merged", TimeRanges{{Start: 1, End: 2}, {Start: 2, End: 3}}, TimeRanges{{Start: 1, End: 3}}, false},
+		{"contained is merged", TimeRanges{{Start: 1, End: 10}, {Start: 2, End: 3}}, TimeRanges{{Start: 1, End: 10}}, false},
+		{"negative start", TimeRanges{{Start: -1, End: 2}}, nil, true},
+		{"empty range", TimeRanges{{Start: 2, End: 2}}, nil, true},
+		{"end before start", TimeRanges{{Start: 3, End: 2}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ranges.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(tt.ranges, tt.want) {
+				t.Errorf("got %v, want %v", tt.ranges, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeRangesInvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges TimeRanges
+		want   TimeRanges
+	}{
+		{"none", TimeRanges{}, TimeRanges{{Start: 0, End: 10}}},
+		{"middle", TimeRanges{{Start: 2, End: 4}}, TimeRanges{{Start: 0, End: 2}, {Start: 4, End: 10}}},
+		{"start and end", TimeRanges{{Start: 0, End: 2}, {Start: 8, End: 10}}, TimeRanges{{Start: 2, End: 8}}},
+		{"past the end", TimeRanges{{Start: 5, End: 20}}, TimeRanges{{Start: 0, End: 5}}},
+		{"everything", TimeRanges{{Start: 0, End: 10}}, TimeRanges{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ranges.Invert(0, 10); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
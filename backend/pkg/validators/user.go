@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"regexp"
 	"slices"
 	"strconv"
@@ -24,6 +25,9 @@ var (
 
 	ErrCropOptionsInvalid = errors.New("invalid cropping options provided")
 
+	ErrWatermarkFileTooBig = errors.New("watermark file is too big")
+	ErrWatermarkNotPNG     = errors.New("watermark has to be a PNG image")
+
 	// Just some usernames that could be misleading/weird with javascript
 	disallowedUsernames = []string{
 		"admin",
@@ -55,13 +59,19 @@ type UserUpdateOpts struct {
 	AvatarCropProper []int
 
 	DefaultPrivateVideos *bool `form:"defaultPrivateVideos"`
+
+	// Image used by the watermark processing option
+	Watermark *multipart.FileHeader `form:"watermark"`
 }
 
 func (u UserUpdateOpts) IsEmpty() bool {
-	return u.Username == "" && u.Avatar == nil && u.PublicProfileEnabled == nil && u.AvatarCrop == "" && u.DefaultPrivateVideos == nil
+	return u.Username == "" && u.Avatar == nil && u.PublicProfileEnabled == nil && u.AvatarCrop == "" && u.DefaultPrivateVideos == nil && u.Watermark == nil
 }
 
-const maxAvatarSize = 5242880
+const (
+	maxAvatarSize    = 5242880
+	maxWatermarkSize = 2097152
+)
 
 func UserValidator(o *UserUpdateOpts) error {
 	if o.IsEmpty() {
@@ -120,6 +130,33 @@ func UserValidator(o *UserUpdateOpts) error {
 		}
 	}
 
+	if o.Watermark != nil {
+		if o.Watermark.Size == 0 {
+			return ErrEmptyFile
+		}
+
+		if o.Watermark.Size > maxWatermarkSize {
+			return ErrWatermarkFileTooBig
+		}
+
+		f, err := o.Watermark.Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// Check the magic bytes instead of trusting the header
+		head := make([]byte, 512)
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		if http.DetectContentType(head[:n]) != "image/png" {
+			return ErrWatermarkNotPNG
+		}
+	}
+
 	if o.AvatarCrop != "" {
 		opts := strings.Split(o.AvatarCrop, ",")
 		if len(opts) != 4 {